@@ -0,0 +1,98 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"time"
+)
+
+/*
+ * adaptive concurrency limit
+ * - per node in-flight limit adjusted by latency and error codes
+ * - server inter, run and node down errors treated as overload
+ * - payload operations give error signal only, cost follows file size
+ * - canceled and caller deadline attempts are not node samples
+ */
+
+//set adaptive limit para, nil means disable
+func (f *Client) SetAdaptiveLimit(para *face.AdaptivePara) {
+	f.Lock()
+	defer f.Unlock()
+	if para == nil {
+		f.adaptive = nil
+		return
+	}
+	f.adaptive = face.NewAdaptiveLimiter(para)
+}
+
+//get adaptive limit of node, zero if disabled
+func (f *Client) GetNodeLimit(tag string) int {
+	adaptive := f.getAdaptive()
+	if adaptive == nil {
+		return 0
+	}
+	return adaptive.GetLimit(tag)
+}
+
+////////////////
+//private func
+////////////////
+
+//get adaptive limiter
+func (f *Client) getAdaptive() *face.AdaptiveLimiter {
+	f.RLock()
+	defer f.RUnlock()
+	return f.adaptive
+}
+
+//acquire adaptive slot of node
+//done func should be called with attempt result
+func (f *Client) acquireAdaptive(
+		ctx context.Context,
+		node *face.OneNode,
+		op *operation,
+	) (func(cost time.Duration, err error), error) {
+	adaptive := f.getAdaptive()
+	if adaptive == nil {
+		return func(time.Duration, error) {}, nil
+	}
+	err := adaptive.Acquire(ctx, node.Tag)
+	if err != nil {
+		return nil, err
+	}
+	done := func(cost time.Duration, err error) {
+		if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)) {
+			//canceled or deadline of caller, not a node sample
+			adaptive.Cancel(node.Tag)
+			return
+		}
+		if op.payload {
+			//no latency sample
+			cost = 0
+		}
+		adaptive.Done(node.Tag, cost, isOverload(err))
+	}
+	return done, nil
+}
+
+//check error means node overload
+//deadline error here comes from transport, not caller context
+func isOverload(err error) bool {
+	var (
+		codeErr *CodeError
+		transportErr *TransportError
+	)
+	if err == nil {
+		return false
+	}
+	if errors.As(err, &codeErr) {
+		switch codeErr.Code {
+		case define.ErrCodeOfInterError, define.ErrCodeOfRunError, define.ErrCodeOfNodeDown:
+			return true
+		}
+		return false
+	}
+	return errors.As(err, &transportErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,145 @@
+package tinyfs_client
+
+import (
+	"context"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+)
+
+/*
+ * client side read cache
+ * - optional memory cache in front of read api
+ * - optional disk cache behind memory cache, full reads only
+ * - reads with packet meta cached in memory under own key, never on disk
+ * - delete and remove api invalidate entries
+ */
+
+//set memory cache para, nil means disable
+func (f *Client) SetMemCache(para *face.MemCachePara) {
+	f.Lock()
+	defer f.Unlock()
+	if para == nil {
+		f.memCache = nil
+		return
+	}
+	f.memCache = face.NewMemCache(para)
+}
+
+//get memory cache stat, nil if cache disabled
+func (f *Client) GetCacheStat() *face.CacheStat {
+	f.RLock()
+	memCache := f.memCache
+	f.RUnlock()
+	if memCache == nil {
+		return nil
+	}
+	stat := memCache.GetStat()
+	return &stat
+}
+
+//set disk cache para, nil means disable
+//valid entries under dir will be reused
+func (f *Client) SetDiskCache(para *face.DiskCachePara) error {
+	if para == nil {
+		f.Lock()
+		f.diskCache = nil
+		f.Unlock()
+		return nil
+	}
+	diskCache, err := face.NewDiskCache(para)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	f.diskCache = diskCache
+	f.Unlock()
+	return nil
+}
+
+//get disk cache stat, nil if cache disabled
+func (f *Client) GetDiskCacheStat() *face.CacheStat {
+	f.RLock()
+	diskCache := f.diskCache
+	f.RUnlock()
+	if diskCache == nil {
+		return nil
+	}
+	stat := diskCache.GetStat()
+	return &stat
+}
+
+////////////////
+//private func
+////////////////
+
+//get cached file, memory first then disk
+//keyed by packet meta of caller like read dedup
+func (f *Client) getCache(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+	) (*json.ReadFileRespJson, bool) {
+	f.RLock()
+	memCache := f.memCache
+	diskCache := f.diskCache
+	f.RUnlock()
+	meta := packetMetaKeyOf(ctx)
+	if memCache != nil {
+		if resp, ok := memCache.Get(req.ShortUrl, req.Start, req.End, meta); ok {
+			return resp, true
+		}
+	}
+	if diskCache == nil || req.Start != 0 || req.End != 0 || meta != "" {
+		return nil, false
+	}
+	resp, ok := diskCache.Get(req.ShortUrl)
+	if !ok {
+		return nil, false
+	}
+	//promote into memory cache
+	if memCache != nil {
+		memCache.Set(req.ShortUrl, req.Start, req.End, meta, resp)
+	}
+	return resp, true
+}
+
+//set cached file
+func (f *Client) setCache(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+		resp *json.ReadFileRespJson,
+	) {
+	f.RLock()
+	memCache := f.memCache
+	diskCache := f.diskCache
+	f.RUnlock()
+	if resp == nil {
+		return
+	}
+	meta := packetMetaKeyOf(ctx)
+	if memCache != nil {
+		memCache.Set(req.ShortUrl, req.Start, req.End, meta, resp)
+	}
+	if diskCache != nil && req.Start == 0 && req.End == 0 && meta == "" {
+		//written in background
+		shortUrl := req.ShortUrl
+		diskCache.SetAsync(shortUrl, resp, func(err error) {
+			f.getLogger().Warn("tinyfs disk cache write failed",
+				LogKeyOfShortUrl, shortUrl,
+				LogKeyOfErr, err)
+		})
+	}
+}
+
+//del cached files
+func (f *Client) delCache(shortUrls ...string) {
+	f.RLock()
+	memCache := f.memCache
+	diskCache := f.diskCache
+	f.RUnlock()
+	if memCache != nil {
+		memCache.Del(shortUrls...)
+	}
+	if diskCache != nil {
+		diskCache.Del(shortUrls...)
+	}
+}
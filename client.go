@@ -1,11 +1,14 @@
 package tinyfs_client
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/codec"
 	"github.com/andyzhou/tinyfs_client/face"
 	"github.com/andyzhou/tinyfs_client/json"
+	"github.com/andyzhou/tinyfs_client/tracing"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 )
@@ -23,6 +26,26 @@ var (
 //face info
 type Client struct {
 	node *face.Node
+	codec codec.Codec //request codec, json by default
+	rawFrame bool //raw payload frame for read and write messages
+	batcher *face.Batcher //optional, for coalescing single reads
+	flight *face.Flight //optional, for deduplicating identical reads
+	hedger *face.Hedger //optional, for hedging slow reads
+	limiter *face.RateLimiter //optional, for client side rate limit
+	adaptive *face.AdaptiveLimiter //optional, for adaptive node concurrency
+	uploadThrottle *face.Throttle //optional, for upload bandwidth limit
+	uploadStore *face.UploadStore //optional, for persisted upload sessions
+	memCache *face.MemCache //optional, for caching file reads
+	diskCache *face.DiskCache //optional, persistent tier behind memory cache
+	digestAlgo int //DigestOfMd5 or DigestOfSha256
+	writeDedup bool //lookup content by digest before write
+	uploadOnNameDiff bool //always upload when existing name differs
+	maxRetries int //max retries of idempotent operations
+	interceptors []UnaryInterceptor
+	metricsSink MetricsSink //optional, for instrumentation
+	tracer tracing.Tracer //no-op tracer by default
+	logger *slog.Logger //slog default logger if nil
+	stat clientStat //client wide counters
 	addressArr []string //unique slice
 	num int32 //atomic value
 	sync.RWMutex
@@ -40,260 +63,269 @@ func GetClient() *Client {
 func NewClient() *Client {
 	this := &Client{
 		node: face.NewNode(),
+		codec: codec.NewJsonCodec(),
+		tracer: tracing.NewNoopTracer(),
 	}
+	this.node.SetEventCallBack(this.cbForNodeEvent)
 	return this
 }
 
 //quit
 func (f *Client) Quit() {
+	if f.batcher != nil {
+		f.batcher.Quit()
+	}
 	f.node.Quit()
 }
 
-//list file info
-func (f *Client) ListFiles(page, pageSize int) (*json.ListFileRespJson, error) {
-	//pick rand master node
-	node, err := f.node.PickNode()
-	if err != nil {
-		return nil, err
+//set read batch para, nil means disable
+//single full reads will be coalesced into multi read request
+func (f *Client) SetReadBatch(para *face.BatchPara) {
+	var batcher *face.Batcher
+	if para != nil {
+		batcher = face.NewBatcher(para, f.readBatchFiles)
 	}
-	if node == nil || node.Client == nil {
-		return nil, errors.New("can't get valid node")
+
+	//swap in locker, quit old one outside
+	//pending calls of old batcher may read batcher again
+	f.Lock()
+	old := f.batcher
+	f.batcher = batcher
+	f.Unlock()
+	if old != nil {
+		old.Quit()
 	}
+}
+
+//list file info
+func (f *Client) ListFiles(page, pageSize int) (*json.ListFileRespJson, error) {
+	return f.ListFilesWithContext(context.Background(), page, pageSize)
+}
 
+//list file info with context
+func (f *Client) ListFilesWithContext(
+		ctx context.Context,
+		page, pageSize int,
+	) (*json.ListFileRespJson, error) {
 	//init list file request
 	reqObj := json.NewListFileReqJson()
 	reqObj.Page = page
 	reqObj.PageSize = pageSize
-
-	//encode request obj
-	reqBytes, subErr := reqObj.Encode(reqObj)
-	if subErr != nil {
-		return nil, subErr
-	}
-
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfListFile
-	pack.Data = reqBytes
-
-	//send request to target node
-	resp, subErrTwo := node.Client.SendRequest(pack)
-	if subErrTwo != nil {
-		return nil, subErrTwo
-	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("read file fialed, code:%v, err:%v\n", resp.ErrCode, resp.ErrMsg)
-		return nil, subErr
-	}
-	//decode origin resp
-	respObj := json.NewListFileRespJson()
-	respObj.Decode(resp.Data, respObj)
-	return respObj, nil
+	return do(ctx, f, opOfListFile, reqObj, json.NewListFileRespJson)
 }
 
 //del file info
 func (f *Client) DelFiles(shortUrls ...string) error {
+	return f.DelFilesWithContext(context.Background(), shortUrls...)
+}
+
+//del file info with context
+func (f *Client) DelFilesWithContext(
+		ctx context.Context,
+		shortUrls ...string,
+	) error {
 	//check
 	if shortUrls == nil || len(shortUrls) <= 0 {
 		return errors.New("invalid parameter")
 	}
 
-	//pick rand master node
-	node, err := f.node.PickNode()
-	if err != nil {
-		return err
-	}
-	if node == nil || node.Client == nil {
-		return errors.New("can't get valid node")
-	}
+	//invalidate cached files
+	defer f.delCache(shortUrls...)
 
 	//init delete file request
 	reqObj := json.NewDeleteFileReqJson()
 	reqObj.ShortUrls = shortUrls
-
-	//encode request obj
-	reqBytes, subErrTwo := reqObj.Encode(reqObj)
-	if subErrTwo != nil {
-		return subErrTwo
-	}
-
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfDelete
-	pack.Data = reqBytes
-
-	//send request to target node
-	resp, subErr := node.Client.SendRequest(pack)
-	if subErr != nil {
-		return subErr
-	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("read file fialed, code:%v, err:%v\n", resp.ErrCode, resp.ErrMsg)
-		return subErr
-	}
-	return nil
+	_, err := do(ctx, f, opOfDelete, reqObj, json.NewBaseJson)
+	return err
 }
 
 //remove file info
 func (f *Client) RemoveFiles(shortUrls ...string) error {
+	return f.RemoveFilesWithContext(context.Background(), shortUrls...)
+}
+
+//remove file info with context
+func (f *Client) RemoveFilesWithContext(
+		ctx context.Context,
+		shortUrls ...string,
+	) error {
 	//check
 	if shortUrls == nil || len(shortUrls) <= 0 {
 		return errors.New("invalid parameter")
 	}
 
-	//pick rand master node
-	node, err := f.node.PickNode()
-	if err != nil {
-		return err
-	}
-	if node == nil || node.Client == nil {
-		return errors.New("can't get valid node")
-	}
+	//invalidate cached files
+	defer f.delCache(shortUrls...)
 
 	//init remove file request
 	reqObj := json.NewRemoveFileReqJson()
 	reqObj.ShortUrls = shortUrls
-
-	//encode request obj
-	reqBytes, subErr := reqObj.Encode(reqObj)
-	if subErr != nil {
-		return subErr
-	}
-
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfRemove
-	pack.Data = reqBytes
-
-	//send request to target master node
-	resp, subErrTwo := node.Client.SendRequest(pack)
-	if subErrTwo != nil {
-		return subErrTwo
-	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("remove file failed, code:%v, err:%v\n", resp.ErrCode, resp.ErrMsg)
-		return subErr
-	}
-	return nil
+	_, err := do(ctx, f, opOfRemove, reqObj, json.NewBaseJson)
+	return err
 }
 
-//read file data
+//read multi files data
+//files may be shared with cache, treat them as read-only
 func (f *Client) ReadMultiFiles(
 		req *json.ReadMultiFilesReqJson,
 	) (*json.ReadMultiFilesRespJson, error) {
+	return f.ReadMultiFilesWithContext(context.Background(), req)
+}
+
+//read multi files data with context
+//files may be shared with cache, treat them as read-only
+//failed files returned by MultiReadError keyed by short url,
+//with resp of other verified files
+func (f *Client) ReadMultiFilesWithContext(
+		ctx context.Context,
+		req *json.ReadMultiFilesReqJson,
+	) (*json.ReadMultiFilesRespJson, error) {
 	//check
 	if req == nil || req.ShortUrls == nil || len(req.ShortUrls) <= 0 {
 		return nil, errors.New("invalid parameter")
 	}
-	//pick active master node
-	node, err := f.node.PickNode()
+
+	//pick cached files first
+	var done int64
+	respObj := json.NewReadMultiFilesRespJson()
+	missReq := json.NewReadMultiFilesReqJson()
+	for _, shortUrl := range req.ShortUrls {
+		subReq := &json.ReadFileReqJson{ShortUrl: shortUrl}
+		file, ok := f.getCache(ctx, subReq)
+		if ok {
+			respObj.Files[shortUrl] = file
+			done += int64(len(file.Data))
+		}else{
+			missReq.ShortUrls = append(missReq.ShortUrls, shortUrl)
+		}
+	}
+	if len(missReq.ShortUrls) <= 0 {
+		reportProgress(req.Progress, done, done)
+		return respObj, nil
+	}
+	reportProgress(req.Progress, done, -1)
+
+	//read and verify missed files
+	para := &callPara{}
+	missResp, err := do(ctx, f, opOfMultiRead, missReq, json.NewReadMultiFilesRespJson, para)
 	if err != nil {
 		return nil, err
 	}
-	if node == nil || node.Client == nil {
-		return nil, errors.New("node client not init")
+	errMap := f.verifyMultiFiles(ctx, para.node, missResp.Files)
+	for shortUrl := range errMap {
+		delete(missResp.Files, shortUrl)
 	}
-	reqBytes, _ := req.Encode(req)
-
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfMultiRead
-	pack.Data = reqBytes
-
-	//send request to target node
-	resp, subErr := node.Client.SendRequest(pack)
-	if subErr != nil {
-		return nil, subErr
+	total := done
+	for _, file := range missResp.Files {
+		total += int64(len(file.Data))
 	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("read multi file failed, code:%v, err:%v\n",
-			resp.ErrCode, resp.ErrMsg)
-		return nil, subErr
+	for shortUrl, file := range missResp.Files {
+		f.setCache(ctx, &json.ReadFileReqJson{ShortUrl: shortUrl}, file)
+		respObj.Files[shortUrl] = file
+		done += int64(len(file.Data))
+		reportProgress(req.Progress, done, total)
+	}
+	if len(errMap) > 0 {
+		//verified files kept in resp
+		return respObj, &MultiReadError{Errs: errMap}
 	}
-
-	//decode origin resp
-	respObj := json.NewReadMultiFilesRespJson()
-	respObj.Decode(resp.Data, respObj)
 	return respObj, nil
 }
 
+//set read dedup switcher
+//identical in-flight reads will share one request and one result
+func (f *Client) SetReadDedup(enable bool) {
+	f.Lock()
+	defer f.Unlock()
+	if !enable {
+		f.flight = nil
+		return
+	}
+	if f.flight == nil {
+		f.flight = face.NewFlight()
+	}
+}
+
+//read file data
+//resp may be shared with cache and identical reads, treat it as read-only
 func (f *Client) ReadFile(
 		req *json.ReadFileReqJson,
 	) (*json.ReadFileRespJson, error) {
+	return f.ReadFileWithContext(context.Background(), req)
+}
+
+//read file data with context
+//resp may be shared with cache and identical reads, treat it as read-only
+func (f *Client) ReadFileWithContext(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+	) (*json.ReadFileRespJson, error) {
 	//check
 	if req == nil || req.ShortUrl == "" {
 		return nil, errors.New("invalid parameter")
 	}
-
-	//pick active node
-	node, err := f.node.PickNode()
-	if err != nil {
-		return nil, err
-	}
-	if node == nil || node.Client == nil {
-		return nil, errors.New("node client not init")
-	}
-	reqBytes, _ := req.Encode(req)
-
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfRead
-	pack.Data = reqBytes
-
-	//send request to target node
-	resp, subErr := node.Client.SendRequest(pack)
-	if subErr != nil {
-		return nil, subErr
-	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("read file failed, code:%v, err:%v\n",
-			resp.ErrCode, resp.ErrMsg)
-		return nil, subErr
-	}
-
-	//decode origin resp
-	respObj := json.NewReadFileRespJson()
-	respObj.Decode(resp.Data, respObj)
-	return respObj, nil
+	return f.readFileWithCache(ctx, req)
 }
 
 //write file data
 func (f *Client) WriteFile(
 		req *json.WriteFileReqJson,
 	) (*json.WriteFileRespJson, error) {
+	return f.WriteFileWithContext(context.Background(), req)
+}
+
+//write file data with context
+//upload limited by upload throttle if setup
+func (f *Client) WriteFileWithContext(
+		ctx context.Context,
+		req *json.WriteFileReqJson,
+	) (*json.WriteFileRespJson, error) {
 	//check
 	if req == nil || req.Name == "" || req.Data == nil {
 		return nil, errors.New("invalid parameter")
 	}
+	size := int64(len(req.Data))
 
-	//pick active node
-	node, err := f.node.PickNode()
+	//fill data digest
+	err := f.fillDigest(req)
 	if err != nil {
 		return nil, err
 	}
-	if node == nil || node.Client == nil {
-		return nil, errors.New("node client not init")
-	}
-	reqBytes, _ := req.Encode(req)
 
-	//gen packet
-	pack := node.Client.GenPacket()
-	pack.MessageId = define.MessageIdOfWrite
-	pack.Data = reqBytes
+	//lookup existing content, lookup failure falls back to upload
+	shortUrl, err := f.lookupExistingFile(ctx, req)
+	if err != nil {
+		f.getLogger().Warn("tinyfs digest lookup failed, upload instead",
+			LogKeyOfOp, opOfLookupDigest.name,
+			LogKeyOfShortUrl, logShortUrl(req),
+			LogKeyOfErr, err)
+	}
+	if shortUrl != "" {
+		respObj := json.NewWriteFileRespJson()
+		respObj.ShortUrl = shortUrl
+		reportProgress(req.Progress, size, size)
+		return respObj, nil
+	}
+
+	//large payload under upload limit sent by throttled parts
+	if f.getUploadThrottle() != nil && size > DefaultUploadPartSize {
+		respObj, subErr := f.writeByParts(ctx, req)
+		if !errors.Is(subErr, ErrUnsupported) {
+			return respObj, subErr
+		}
+		//server without chunk upload, send in one message
+	}
 
-	//send request to target chunk node
-	resp, subErr := node.Client.SendRequest(pack)
-	if subErr != nil {
-		return nil, subErr
+	//wait upload bytes admitted
+	err = f.waitUpload(ctx, size, req.Progress)
+	if err != nil {
+		return nil, err
 	}
-	if resp.ErrCode != define.ErrCodeOfSucceed {
-		subErr = fmt.Errorf("send file failed, code:%v, err:%v\n", resp.ErrCode, resp.ErrMsg)
-		return nil, subErr
+	respObj, err := do(ctx, f, opOfWrite, req, json.NewWriteFileRespJson)
+	if err != nil {
+		return nil, err
 	}
-
-	//decode origin response data
-	respObj := json.NewWriteFileRespJson()
-	respObj.Decode(resp.Data, respObj)
+	reportProgress(req.Progress, size, size)
 	return respObj, nil
 }
 
@@ -318,9 +350,29 @@ func (f *Client) RemoveNode(addr string) error {
 	return err
 }
 
+//drain master node and remove it after in-flight requests done
+//addr format -> host:port
+func (f *Client) DrainAndRemove(ctx context.Context, addr string) error {
+	//check
+	if addr == "" {
+		return errors.New("invalid parameter")
+	}
+	return f.node.DrainAndRemove(ctx, addr)
+}
+
 //add master node
 //addr format -> host:port
 func (f *Client) AddNode(addr string, maxMsgSizes ...int) error {
+	return f.AddNodeWithLabels(addr, nil, maxMsgSizes...)
+}
+
+//add master node with labels of zone, region and weight
+//addr format -> host:port
+func (f *Client) AddNodeWithLabels(
+		addr string,
+		labels *face.NodeLabels,
+		maxMsgSizes ...int,
+	) error {
 	//check
 	if addr == "" {
 		return errors.New("invalid parameter")
@@ -330,15 +382,118 @@ func (f *Client) AddNode(addr string, maxMsgSizes ...int) error {
 	}
 	//add new node
 	tag := fmt.Sprintf("%v", f.num)
-	f.node.AddNode(tag, addr, maxMsgSizes...)
+	f.node.AddNodeWithLabels(tag, addr, labels, maxMsgSizes...)
 	atomic.AddInt32(&f.num, 1)
 	return nil
 }
 
+//set client locality, nil means disable
+//same zone nodes preferred, spill over when they are unhealthy or overloaded
+func (f *Client) SetLocality(para *face.LocalityPara) {
+	f.node.SetLocality(para)
+}
+
 ///////////////
 //private func
 ///////////////
 
+//read file data with cache, dedup and batch
+func (f *Client) readFileWithCache(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+	) (*json.ReadFileRespJson, error) {
+	//try cached file first
+	if respObj, ok := f.getCache(ctx, req); ok {
+		return respObj, nil
+	}
+
+	//identical in-flight reads share one call
+	f.RLock()
+	flight := f.flight
+	f.RUnlock()
+	if flight == nil {
+		respObj, err := f.readFileByBatch(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		f.setCache(ctx, req, respObj)
+		return respObj, nil
+	}
+	//reads with different packet meta never share one call, same as cache
+	key := face.CacheKey(req.ShortUrl, req.Start, req.End) + packetMetaKeyOf(ctx)
+	sf := func(subCtx context.Context) (interface{}, error) {
+		respObj, err := f.readFileByBatch(subCtx, req)
+		if err != nil {
+			return nil, err
+		}
+		f.setCache(subCtx, req, respObj)
+		return respObj, nil
+	}
+	val, err, _ := flight.Do(ctx, key, sf)
+	if err != nil {
+		return nil, err
+	}
+	respObj, _ := val.(*json.ReadFileRespJson)
+	return respObj, nil
+}
+
+//read batch files, cb for batcher
+func (f *Client) readBatchFiles(
+		ctx context.Context,
+		shortUrls []string,
+	) (map[string]*json.ReadFileRespJson, map[string]error, error) {
+	req := json.NewReadMultiFilesReqJson()
+	req.ShortUrls = shortUrls
+	para := &callPara{}
+	resp, err := do(ctx, f, opOfMultiRead, req, json.NewReadMultiFilesRespJson, para)
+	if err != nil {
+		return nil, nil, err
+	}
+	errMap := f.verifyMultiFiles(ctx, para.node, resp.Files)
+	return resp.Files, errMap, nil
+}
+
+//read single file data, full read can be coalesced by batcher
+func (f *Client) readFileByBatch(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+	) (*json.ReadFileRespJson, error) {
+	f.RLock()
+	batcher := f.batcher
+	f.RUnlock()
+	//reads with packet meta sent alone, batch carries values of first caller only
+	if batcher != nil && req.Start == 0 && req.End == 0 && len(GetPacketMeta(ctx)) <= 0 {
+		return batcher.Read(ctx, req.ShortUrl)
+	}
+	return f.readFile(ctx, req)
+}
+
+//read single file data, hedged if setup
+//full read verified, retry once on different node if mismatch
+func (f *Client) readFile(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+	) (*json.ReadFileRespJson, error) {
+	para := &callPara{}
+	respObj, err := f.readByHedge(ctx, req, para)
+	if err != nil {
+		return nil, err
+	}
+	if req.Start != 0 || req.End != 0 {
+		return respObj, nil
+	}
+	err = f.verifyDigest(req.ShortUrl, respObj)
+	if err != nil {
+		f.getLogger().Warn("tinyfs read checksum mismatch, retry on other node",
+			LogKeyOfOp, opOfRead.name,
+			LogKeyOfNode, para.node.Address,
+			LogKeyOfShortUrl, req.ShortUrl,
+			LogKeyOfErr, err)
+		return f.retryVerifiedRead(ctx, para.node, req, err)
+	}
+	return respObj, nil
+}
+
 //check address
 func (f *Client) checkAddress(addr string) bool {
 	f.Lock()
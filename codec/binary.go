@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/define"
+)
+
+/*
+ * compact binary codec
+ * - raw payload frame with json header
+ * - payload of PayloadCarrier objects kept out of json header
+ * - other objects are framed with json header only
+ */
+
+//face info
+type BinaryCodec struct {
+}
+
+//construct
+func NewBinaryCodec() *BinaryCodec {
+	this := &BinaryCodec{}
+	return this
+}
+
+//get name
+func (c *BinaryCodec) Name() string {
+	return define.CodecOfBinary
+}
+
+//encode obj
+func (c *BinaryCodec) Marshal(v interface{}) ([]byte, error) {
+	var (
+		payload []byte
+		headerObj = v
+	)
+	//check
+	if v == nil {
+		return nil, errors.New("invalid parameter")
+	}
+
+	//pick payload, encode header with shallow copy
+	if carrier, ok := v.(PayloadCarrier); ok {
+		payload = carrier.GetPayload()
+		headerObj = CopyWithoutPayload(v)
+	}
+	header, err := json.Marshal(headerObj)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 0, 1 + binary.MaxVarintLen64 + len(header) + len(payload))
+	return AppendFrame(frame, header, payload), nil
+}
+
+//decode obj
+//payload refers to data, no copy
+func (c *BinaryCodec) Unmarshal(data []byte, v interface{}) error {
+	header, payload, err := DecodeFrame(data)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(header, v)
+	if err != nil {
+		return err
+	}
+	if carrier, ok := v.(PayloadCarrier); ok && len(payload) > 0 {
+		carrier.SetPayload(payload)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"errors"
+	"sync"
+)
+
+/*
+ * wire codec face
+ * - encode and decode request and response objects
+ * - codec name is stamped into packet meta, agreed with server
+ */
+
+//codec interface
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//payload carrier, for message with raw file bytes
+type PayloadCarrier interface {
+	GetPayload() []byte
+	SetPayload(data []byte)
+}
+
+//global variable
+var (
+	_codecMap = map[string]Codec{}
+	_codecLocker sync.RWMutex
+)
+
+//register inter codecs
+func init() {
+	Register(NewJsonCodec())
+	Register(NewMsgPackCodec())
+	Register(NewBinaryCodec())
+}
+
+//register codec
+func Register(c Codec) error {
+	//check
+	if c == nil || c.Name() == "" {
+		return errors.New("invalid parameter")
+	}
+	_codecLocker.Lock()
+	defer _codecLocker.Unlock()
+	_codecMap[c.Name()] = c
+	return nil
+}
+
+//get codec by name
+func Get(name string) (Codec, error) {
+	//check
+	if name == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	_codecLocker.RLock()
+	defer _codecLocker.RUnlock()
+	c, ok := _codecMap[name]
+	if !ok || c == nil {
+		return nil, errors.New("no such codec")
+	}
+	return c, nil
+}
+
+//get all codec names
+func Names() []string {
+	_codecLocker.RLock()
+	defer _codecLocker.RUnlock()
+	names := make([]string, 0, len(_codecMap))
+	for name := range _codecMap {
+		names = append(names, name)
+	}
+	return names
+}
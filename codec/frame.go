@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+)
+
+/*
+ * raw payload frame
+ * - layout: [version byte][uvarint header size][header][raw payload]
+ * - header is small meta object, file bytes follow as raw trailer
+ * - decoded payload refers to frame data, no copy
+ */
+const (
+	FrameVersion = 1
+)
+
+//append frame into dst
+func AppendFrame(dst, header, payload []byte) []byte {
+	var (
+		sizeBuf [binary.MaxVarintLen64]byte
+	)
+	n := binary.PutUvarint(sizeBuf[:], uint64(len(header)))
+	dst = append(dst, FrameVersion)
+	dst = append(dst, sizeBuf[:n]...)
+	dst = append(dst, header...)
+	dst = append(dst, payload...)
+	return dst
+}
+
+//encode frame into pooled buffer
+//release it by PutBuffer after sent
+func EncodeFrame(header, payload []byte) []byte {
+	size := 1 + binary.MaxVarintLen64 + len(header) + len(payload)
+	return AppendFrame(GetBuffer(size)[:0], header, payload)
+}
+
+//decode frame, header and payload refer to data
+func DecodeFrame(data []byte) (header, payload []byte, err error) {
+	//check
+	if len(data) <= 1 {
+		return nil, nil, errors.New("frame data is empty")
+	}
+	if data[0] != FrameVersion {
+		return nil, nil, errors.New("invalid frame version")
+	}
+	headerSize, n := binary.Uvarint(data[1:])
+	if n <= 0 || uint64(len(data) - 1 - n) < headerSize {
+		return nil, nil, errors.New("invalid frame data")
+	}
+	headerStart := 1 + n
+	headerEnd := headerStart + int(headerSize)
+	return data[headerStart:headerEnd], data[headerEnd:], nil
+}
+
+//shallow copy payload carrier without payload
+func CopyWithoutPayload(v interface{}) interface{} {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return v
+	}
+	newVal := reflect.New(val.Elem().Type())
+	newVal.Elem().Set(val.Elem())
+	carrier, ok := newVal.Interface().(PayloadCarrier)
+	if !ok {
+		return v
+	}
+	carrier.SetPayload(nil)
+	return carrier
+}
@@ -0,0 +1,133 @@
+package codec
+
+import (
+	"bytes"
+	encJson "encoding/json"
+	"fmt"
+	"testing"
+)
+
+/*
+ * raw frame test and benchmark
+ * - json body path, file bytes inside json body
+ * - raw frame path, small header with raw payload trailer
+ */
+
+var (
+	benchPayloadSizes = []int{1024 * 4, 1024 * 256, 1024 * 1024 * 4}
+)
+
+//payload carrier for test
+type frameReq struct {
+	Name string `json:"name"`
+	Size int64 `json:"size"`
+	Data []byte `json:"data"`
+}
+
+func (r *frameReq) GetPayload() []byte {
+	return r.Data
+}
+func (r *frameReq) SetPayload(data []byte) {
+	r.Data = data
+}
+
+//gen request with payload of size
+func genFrameReq(size int) *frameReq {
+	req := &frameReq{
+		Name: "bench.bin",
+		Size: int64(size),
+		Data: make([]byte, size),
+	}
+	for i := range req.Data {
+		req.Data[i] = byte(i)
+	}
+	return req
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	req := genFrameReq(1024 * 8)
+	jsonCodec := NewJsonCodec()
+	header, err := jsonCodec.Marshal(CopyWithoutPayload(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := EncodeFrame(header, req.Data)
+	defer PutBuffer(frame)
+
+	subHeader, payload, err := DecodeFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &frameReq{}
+	err = jsonCodec.Unmarshal(subHeader, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != req.Name || resp.Size != req.Size || resp.Data != nil {
+		t.Fatalf("header not matched, %+v", resp)
+	}
+	if !bytes.Equal(payload, req.Data) {
+		t.Fatal("payload not matched")
+	}
+	if req.Data == nil {
+		t.Fatal("origin payload changed by header copy")
+	}
+
+	//broken frames
+	if _, _, err = DecodeFrame(frame[:1]); err == nil {
+		t.Fatal("empty frame decoded")
+	}
+	if _, _, err = DecodeFrame(append([]byte{FrameVersion + 1}, frame[1:]...)); err == nil {
+		t.Fatal("invalid version decoded")
+	}
+}
+
+func BenchmarkJsonBody(b *testing.B) {
+	for _, size := range benchPayloadSizes {
+		req := genFrameReq(size)
+		b.Run(fmt.Sprintf("size-%v", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				data, err := encJson.Marshal(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				resp := &frameReq{}
+				err = encJson.Unmarshal(data, resp)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRawFrame(b *testing.B) {
+	jsonCodec := NewJsonCodec()
+	for _, size := range benchPayloadSizes {
+		req := genFrameReq(size)
+		b.Run(fmt.Sprintf("size-%v", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				header, err := jsonCodec.Marshal(CopyWithoutPayload(req))
+				if err != nil {
+					b.Fatal(err)
+				}
+				frame := EncodeFrame(header, req.Data)
+				subHeader, payload, err := DecodeFrame(frame)
+				if err != nil {
+					b.Fatal(err)
+				}
+				resp := &frameReq{}
+				err = jsonCodec.Unmarshal(subHeader, resp)
+				if err != nil {
+					b.Fatal(err)
+				}
+				resp.SetPayload(payload)
+				PutBuffer(frame)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/define"
+)
+
+/*
+ * json codec, default one
+ */
+
+//face info
+type JsonCodec struct {
+}
+
+//construct
+func NewJsonCodec() *JsonCodec {
+	this := &JsonCodec{}
+	return this
+}
+
+//get name
+func (c *JsonCodec) Name() string {
+	return define.CodecOfJson
+}
+
+//encode obj
+func (c *JsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	return json.Marshal(v)
+}
+
+//decode obj
+func (c *JsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) <= 0 {
+		return errors.New("json data is empty")
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+/*
+ * message pack codec
+ * - reuse json tags of json objects
+ * - raw bytes without base64
+ */
+
+//face info
+type MsgPackCodec struct {
+}
+
+//construct
+func NewMsgPackCodec() *MsgPackCodec {
+	this := &MsgPackCodec{}
+	return this
+}
+
+//get name
+func (c *MsgPackCodec) Name() string {
+	return define.CodecOfMsgPack
+}
+
+//encode obj
+func (c *MsgPackCodec) Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	buffer := bytes.NewBuffer(nil)
+	encoder := msgpack.NewEncoder(buffer)
+	encoder.SetCustomStructTag("json")
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+//decode obj
+func (c *MsgPackCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) <= 0 {
+		return errors.New("msgpack data is empty")
+	}
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
@@ -0,0 +1,63 @@
+package codec
+
+import (
+	"sync"
+)
+
+/*
+ * byte buffer pool
+ * - power of two size classes
+ * - buffers larger than max class are not pooled
+ */
+const (
+	BufferMinClassBits = 12 //4KB
+	BufferMaxClassBits = 24 //16MB
+)
+
+//global variable
+var (
+	_bufferPools [BufferMaxClassBits - BufferMinClassBits + 1]sync.Pool
+)
+
+//get buffer with length of size
+func GetBuffer(size int) []byte {
+	idx := bufferClass(size)
+	if idx < 0 {
+		return make([]byte, size)
+	}
+	if v := _bufferPools[idx].Get(); v != nil {
+		buf := v.(*[]byte)
+		return (*buf)[:size]
+	}
+	return make([]byte, size, 1 << (idx + BufferMinClassBits))
+}
+
+//put buffer back to pool
+//caller should not use it any more
+func PutBuffer(buf []byte) {
+	size := cap(buf)
+	if size < 1 << BufferMinClassBits || size > 1 << BufferMaxClassBits {
+		//too small or too large, not pooled
+		return
+	}
+	//put into largest class which fits
+	idx := -1
+	for bits := BufferMinClassBits; bits <= BufferMaxClassBits; bits++ {
+		if size < 1 << bits {
+			break
+		}
+		idx = bits - BufferMinClassBits
+	}
+	buf = buf[:0]
+	_bufferPools[idx].Put(&buf)
+}
+
+//get class index of size, -1 means not pooled
+func bufferClass(size int) int {
+	for bits := BufferMinClassBits; bits <= BufferMaxClassBits; bits++ {
+		if size <= 1 << bits {
+			return bits - BufferMinClassBits
+		}
+	}
+	return -1
+}
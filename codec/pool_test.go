@@ -0,0 +1,28 @@
+package codec
+
+import (
+	"testing"
+)
+
+/*
+ * buffer pool test
+ * - buffer got by size class capacity
+ * - buffers larger than max class never pooled
+ */
+
+func TestBufferPoolClass(t *testing.T) {
+	buf := GetBuffer(5000)
+	if len(buf) != 5000 || cap(buf) != 1 << 13 {
+		t.Fatalf("unexpected buffer len:%v, cap:%v", len(buf), cap(buf))
+	}
+	PutBuffer(buf)
+}
+
+func TestBufferPoolTooLarge(t *testing.T) {
+	maxSize := 1 << BufferMaxClassBits
+	PutBuffer(make([]byte, 0, maxSize * 2))
+	buf := GetBuffer(maxSize)
+	if cap(buf) > maxSize {
+		t.Fatalf("buffer over max class pooled, cap:%v", cap(buf))
+	}
+}
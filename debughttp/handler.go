@@ -0,0 +1,255 @@
+package debughttp
+
+import (
+	"encoding/json"
+	tinyfs "github.com/andyzhou/tinyfs_client"
+	"github.com/andyzhou/tinyfs_client/face"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * admin http debug handler
+ * - node table, balancer state, cache stats and recent errors
+ * - html at index, json at /json
+ * - node drain, undrain and reconnect as post actions
+ */
+const (
+	PathOfIndex = "/"
+	PathOfJson = "/json"
+	PathOfDrain = "/drain"
+	PathOfUndrain = "/undrain"
+	PathOfReconnect = "/reconnect"
+	FormKeyOfTag = "tag"
+	QueryKeyOfFormat = "format"
+	FormatOfJson = "json"
+)
+
+//one node row
+type NodeRow struct {
+	face.NodeStat
+	Version int `json:"version"`
+	Caps []string `json:"caps"`
+	Limit int `json:"limit"` //adaptive limit, zero if disabled
+}
+
+//balancer state
+type BalancerState struct {
+	Policy string `json:"policy"`
+	Zone string `json:"zone"` //client zone
+	Region string `json:"region"` //client region
+	Pickable []string `json:"pickable"` //healthy and not draining
+	Draining []string `json:"draining"`
+}
+
+//whole client state
+type State struct {
+	Nodes []NodeRow `json:"nodes"`
+	Balancer BalancerState `json:"balancer"`
+	Client *tinyfs.ClientStat `json:"client"`
+}
+
+//action result
+type actionResult struct {
+	Ok bool `json:"ok"`
+	Err string `json:"err,omitempty"`
+}
+
+//get http handler of client
+//mount with http.StripPrefix when not served at root
+func Handler(client *tinyfs.Client) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathOfIndex, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PathOfIndex {
+			http.NotFound(w, r)
+			return
+		}
+		state := GetState(client)
+		if r.URL.Query().Get(QueryKeyOfFormat) == FormatOfJson {
+			writeJson(w, http.StatusOK, state)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		indexTpl.Execute(w, state)
+	})
+	mux.HandleFunc(PathOfJson, func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, GetState(client))
+	})
+	mux.HandleFunc(PathOfDrain, actionHandler(client.GetNode().Drain))
+	mux.HandleFunc(PathOfUndrain, actionHandler(client.GetNode().Undrain))
+	mux.HandleFunc(PathOfReconnect, actionHandler(client.GetNode().Reconnect))
+	return mux
+}
+
+//get client state
+func GetState(client *tinyfs.Client) *State {
+	state := &State{
+		Nodes: []NodeRow{},
+		Balancer: BalancerState{
+			Policy: client.GetNode().GetPickPolicy(),
+			Pickable: []string{},
+			Draining: []string{},
+		},
+		Client: client.Stats(),
+	}
+	if locality := client.GetNode().GetLocality(); locality != nil {
+		state.Balancer.Zone = locality.Zone
+		state.Balancer.Region = locality.Region
+	}
+	allNodes := client.GetNode().GetAllNode()
+	for _, nodeStat := range state.Client.Nodes {
+		row := NodeRow{
+			NodeStat: nodeStat,
+			Caps: []string{},
+			Limit: client.GetNodeLimit(nodeStat.Tag),
+		}
+		if node, ok := allNodes[nodeStat.Tag]; ok {
+			row.Version = node.GetVersion()
+			row.Caps = node.GetCaps()
+			sort.Strings(row.Caps)
+		}
+		state.Nodes = append(state.Nodes, row)
+		if row.Draining {
+			state.Balancer.Draining = append(state.Balancer.Draining, row.Tag)
+		}else if row.Healthy {
+			state.Balancer.Pickable = append(state.Balancer.Pickable, row.Tag)
+		}
+	}
+	//node stats shown in node table only
+	state.Client.Nodes = nil
+	return state
+}
+
+////////////////
+//private func
+////////////////
+
+//gen post action handler by node tag
+func actionHandler(action func(tag string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tag := r.FormValue(FormKeyOfTag)
+		if tag == "" {
+			http.Error(w, "invalid parameter", http.StatusBadRequest)
+			return
+		}
+		err := action(tag)
+		if r.URL.Query().Get(QueryKeyOfFormat) == FormatOfJson {
+			result := actionResult{Ok: err == nil}
+			status := http.StatusOK
+			if err != nil {
+				result.Err = err.Error()
+				status = http.StatusBadRequest
+			}
+			writeJson(w, status, result)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//back to index page, relative to mount path
+		http.Redirect(w, r, "./", http.StatusSeeOther)
+	}
+}
+
+//write json response
+func writeJson(w http.ResponseWriter, status int, val interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(val)
+}
+
+//index page template
+var indexTpl = template.Must(template.New("index").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"ms": func(d time.Duration) string {
+		return d.Round(time.Microsecond).String()
+	},
+	"ts": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>tinyfs client</title>
+<style>
+body { font-family: monospace; margin: 16px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h2>nodes</h2>
+<table>
+<tr><th>tag</th><th>address</th><th>zone</th><th>region</th><th>weight</th><th>connected</th><th>healthy</th><th>draining</th><th>version</th>
+<th>in-flight</th><th>limit</th><th>requests</th><th>errors</th><th>p50</th><th>p99</th>
+<th>last error</th><th>last reconnect</th><th>actions</th></tr>
+{{range .Nodes}}
+<tr><td>{{.Tag}}</td><td>{{.Address}}</td><td>{{.Zone}}</td><td>{{.Region}}</td><td>{{.Weight}}</td><td>{{.Connected}}</td><td>{{.Healthy}}</td><td>{{.Draining}}</td>
+<td>{{.Version}}</td><td>{{.InFlight}}</td><td>{{.Limit}}</td><td>{{.Requests}}</td>
+<td>{{range $code, $num := .Errors}}{{$code}}:{{$num}} {{end}}</td>
+<td>{{ms .P50}}</td><td>{{ms .P99}}</td>
+<td>{{ts .LastErrorAt}} {{.LastError}}</td><td>{{ts .LastReconnectAt}}</td>
+<td>
+{{if .Draining}}
+<form method="post" action="undrain"><input type="hidden" name="tag" value="{{.Tag}}"><button>undrain</button></form>
+{{else}}
+<form method="post" action="drain"><input type="hidden" name="tag" value="{{.Tag}}"><button>drain</button></form>
+{{end}}
+<form method="post" action="reconnect"><input type="hidden" name="tag" value="{{.Tag}}"><button>reconnect</button></form>
+</td></tr>
+{{end}}
+</table>
+
+<h2>balancer</h2>
+<table>
+<tr><th>policy</th><td>{{.Balancer.Policy}}</td></tr>
+<tr><th>zone</th><td>{{.Balancer.Zone}} {{.Balancer.Region}}</td></tr>
+<tr><th>pickable</th><td>{{join .Balancer.Pickable ", "}}</td></tr>
+<tr><th>draining</th><td>{{join .Balancer.Draining ", "}}</td></tr>
+</table>
+
+{{with .Client}}
+<h2>client</h2>
+<table>
+<tr><th>healthy nodes</th><td>{{.HealthyNodes}}</td></tr>
+<tr><th>in-flight</th><td>{{.InFlight}}</td></tr>
+<tr><th>requests</th><td>{{.Requests}}</td></tr>
+<tr><th>retries</th><td>{{.Retries}}</td></tr>
+<tr><th>hedges</th><td>{{.Hedges}}</td></tr>
+<tr><th>errors</th><td>{{range $code, $num := .Errors}}{{$code}}:{{$num}} {{end}}</td></tr>
+</table>
+
+<h2>cache</h2>
+<table>
+<tr><th>tier</th><th>hits</th><th>misses</th><th>evictions</th><th>entries</th><th>bytes</th></tr>
+{{with .MemCache}}<tr><td>memory</td><td>{{.Hits}}</td><td>{{.Misses}}</td><td>{{.Evictions}}</td><td>{{.Entries}}</td><td>{{.Bytes}}</td></tr>{{end}}
+{{with .DiskCache}}<tr><td>disk</td><td>{{.Hits}}</td><td>{{.Misses}}</td><td>{{.Evictions}}</td><td>{{.Entries}}</td><td>{{.Bytes}}</td></tr>{{end}}
+</table>
+
+<h2>recent errors</h2>
+<table>
+<tr><th>time</th><th>op</th><th>node</th><th>short url</th><th>code</th><th>err</th></tr>
+{{range .RecentErrors}}
+<tr><td>{{ts .Time}}</td><td>{{.Op}}</td><td>{{.Node}}</td><td>{{.ShortUrl}}</td><td>{{.Code}}</td><td>{{.Err}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,175 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"fmt"
+	tinyfs "github.com/andyzhou/tinyfs_client"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyrpc"
+	"github.com/andyzhou/tinyrpc/proto"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+/*
+ * debug handler test
+ * - json state shape of node table, balancer and client stats
+ * - node actions are post only, tag required
+ * - html action redirects back to index
+ */
+
+//init client with one node of local rpc service
+func newDebugClient(t *testing.T) (*tinyfs.Client, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	//service without handshake
+	service := tinyrpc.NewService(&tinyrpc.ServicePara{Port: port})
+	service.SetCBForGeneral(func(addr string, in *proto.Packet) (*proto.Packet, error) {
+		return &proto.Packet{
+			MessageId: in.MessageId,
+			ErrCode: define.ErrCodeOfNoCallBack,
+		}, nil
+	})
+	err = service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Quit)
+
+	client := tinyfs.NewClient()
+	t.Cleanup(client.Quit)
+	addr := fmt.Sprintf("127.0.0.1:%v", port)
+	err = client.AddNode(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, addr
+}
+
+//send request to handler
+func doDebugRequest(handler http.Handler, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}else{
+		req = httptest.NewRequest(method, target, nil)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+//get json state
+func getDebugState(t *testing.T, handler http.Handler, target string) *State {
+	rec := doDebugRequest(handler, http.MethodGet, target, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%v status %v", target, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Fatalf("%v content type %v", target, contentType)
+	}
+	state := &State{}
+	err := json.Unmarshal(rec.Body.Bytes(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestHandlerState(t *testing.T) {
+	client, addr := newDebugClient(t)
+	handler := Handler(client)
+
+	//raw shape
+	rec := doDebugRequest(handler, http.MethodGet, PathOfJson, nil)
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(rec.Body.Bytes(), &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"nodes", "balancer", "client"} {
+		if _, ok := raw[key]; !ok {
+			t.Fatalf("state key %v missed, body:%s", key, rec.Body.Bytes())
+		}
+	}
+
+	for _, target := range []string{PathOfJson, PathOfIndex + "?format=json"} {
+		state := getDebugState(t, handler, target)
+		if len(state.Nodes) != 1 || state.Nodes[0].Address != addr {
+			t.Fatalf("unexpected nodes %+v", state.Nodes)
+		}
+		row := state.Nodes[0]
+		if !row.Healthy || row.Draining || len(row.Caps) <= 0 {
+			t.Fatalf("unexpected node row %+v", row)
+		}
+		if len(state.Balancer.Pickable) != 1 || state.Balancer.Pickable[0] != row.Tag {
+			t.Fatalf("unexpected balancer %+v", state.Balancer)
+		}
+		if state.Client == nil || state.Client.Nodes != nil {
+			t.Fatalf("unexpected client stat %+v", state.Client)
+		}
+	}
+
+	//html index and unknown path
+	rec = doDebugRequest(handler, http.MethodGet, PathOfIndex, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), addr) {
+		t.Fatalf("index status %v", rec.Code)
+	}
+	rec = doDebugRequest(handler, http.MethodGet, "/nope", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown path status %v", rec.Code)
+	}
+}
+
+func TestHandlerActions(t *testing.T) {
+	client, _ := newDebugClient(t)
+	handler := Handler(client)
+	tag := getDebugState(t, handler, PathOfJson).Nodes[0].Tag
+
+	//post only
+	for _, path := range []string{PathOfDrain, PathOfUndrain, PathOfReconnect} {
+		rec := doDebugRequest(handler, http.MethodGet, path + "?tag=" + tag, nil)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+			t.Fatalf("%v by get, status %v", path, rec.Code)
+		}
+		rec = doDebugRequest(handler, http.MethodPost, path, url.Values{})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%v without tag, status %v", path, rec.Code)
+		}
+	}
+
+	//drain from html, redirect back to index
+	rec := doDebugRequest(handler, http.MethodPost, PathOfDrain, url.Values{FormKeyOfTag: {tag}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != PathOfIndex {
+		t.Fatalf("drain status %v, location %v", rec.Code, rec.Header().Get("Location"))
+	}
+	state := getDebugState(t, handler, PathOfJson)
+	if len(state.Balancer.Draining) != 1 || len(state.Balancer.Pickable) != 0 {
+		t.Fatalf("node not drained %+v", state.Balancer)
+	}
+
+	//undrain in json
+	rec = doDebugRequest(handler, http.MethodPost, PathOfUndrain + "?format=json", url.Values{FormKeyOfTag: {tag}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok": true`) {
+		t.Fatalf("undrain status %v, body %s", rec.Code, rec.Body.Bytes())
+	}
+	if state = getDebugState(t, handler, PathOfJson); len(state.Balancer.Draining) != 0 {
+		t.Fatalf("node not undrained %+v", state.Balancer)
+	}
+
+	//unknown tag
+	rec = doDebugRequest(handler, http.MethodPost, PathOfDrain + "?format=json", url.Values{FormKeyOfTag: {"missing"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"ok": false`) {
+		t.Fatalf("drain unknown tag status %v, body %s", rec.Code, rec.Body.Bytes())
+	}
+}
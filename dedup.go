@@ -0,0 +1,69 @@
+package tinyfs_client
+
+import (
+	"context"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/json"
+)
+
+/*
+ * content-addressed deduplicating writes
+ * - hash content first, lookup master by digest
+ * - return existing short url instead of uploading again
+ * - lookup sent only to nodes advertising lookup capability
+ */
+
+//set write dedup switcher
+//uploadOnNameDiff means always upload when existing name differs
+func (f *Client) SetWriteDedup(enable, uploadOnNameDiff bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.writeDedup = enable
+	f.uploadOnNameDiff = uploadOnNameDiff
+}
+
+////////////////
+//private func
+////////////////
+
+//lookup existing file for write request
+//return empty short url if should upload
+func (f *Client) lookupExistingFile(
+		ctx context.Context,
+		req *json.WriteFileReqJson,
+	) (string, error) {
+	f.RLock()
+	writeDedup := f.writeDedup
+	uploadOnNameDiff := f.uploadOnNameDiff
+	f.RUnlock()
+	if !writeDedup {
+		return "", nil
+	}
+
+	//init lookup request
+	reqObj := json.NewLookupDigestReqJson()
+	reqObj.Md5 = req.Md5
+	reqObj.Sha256 = req.Sha256
+	reqObj.Size = int64(len(req.Data))
+	reqObj.Name = req.Name
+
+	//send lookup request to nodes with lookup capability
+	excludeTags, ok := f.excludeWithoutCap(define.CapOfLookupDigest)
+	if !ok {
+		return "", nil
+	}
+	para := &callPara{
+		excludeTags: excludeTags,
+	}
+	respObj, err := do(ctx, f, opOfLookupDigest, reqObj, json.NewLookupDigestRespJson, para)
+	if err != nil {
+		return "", err
+	}
+	if !respObj.Exists || respObj.ShortUrl == "" {
+		return "", nil
+	}
+	if uploadOnNameDiff && respObj.Name != req.Name {
+		return "", nil
+	}
+	return respObj.ShortUrl, nil
+}
@@ -0,0 +1,33 @@
+package tinyfs_client
+
+import (
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/json"
+	"testing"
+)
+
+/*
+ * write dedup test
+ * - server without lookup capability gets no lookup request
+ */
+
+func TestWriteDedupWithoutLookupCap(t *testing.T) {
+	client, _, server := newTraceClient(t)
+	client.SetWriteDedup(true, false)
+	req := json.NewWriteFileReqJson()
+	req.Name = "a.txt"
+	req.Data = []byte("hello")
+	_, err := client.WriteFile(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := server.countOf(define.MessageIdOfLookupDigest); count != 0 {
+		t.Fatalf("lookup sent %v times to server without capability", count)
+	}
+	if count := server.countOf(define.MessageIdOfWrite); count != 1 {
+		t.Fatalf("expect one write, got %v", count)
+	}
+	if errs := client.getRecentErrors(); len(errs) > 0 {
+		t.Fatalf("unexpected error records %v", errs)
+	}
+}
@@ -1,12 +1,13 @@
 package define
 
+//error code
+//values are part of wire protocol, never reorder or reuse them
 const (
-	ErrCodeOfSucceed = iota
-	ErrCodeOfInvalidPara
-	ErrCodeOfInterError
-	ErrCodeOfNodeDown
-	ErrCodeOfNoSuchData
-	ErrCodeOfNoCallBack
-	ErrCodeOfRunError
+	ErrCodeOfSucceed = 0
+	ErrCodeOfInvalidPara = 1
+	ErrCodeOfInterError = 2
+	ErrCodeOfNodeDown = 3
+	ErrCodeOfNoSuchData = 4
+	ErrCodeOfNoCallBack = 5
+	ErrCodeOfRunError = 6
 )
-
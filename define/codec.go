@@ -0,0 +1,21 @@
+package define
+
+//codec name
+const (
+	CodecOfJson = "json"
+	CodecOfMsgPack = "msgpack"
+	CodecOfBinary = "binary"
+)
+
+//packet meta key
+//packet meta kept in packet act field as url query string
+const (
+	PacketMetaOfCodec = "codec"
+	PacketMetaOfFrame = "frame" //frame of packet data
+	PacketMetaOfAcceptFrame = "acceptFrame" //frame accepted in reply
+)
+
+//packet frame
+const (
+	FrameOfRaw = "raw" //small header with raw payload trailer
+)
@@ -0,0 +1,7 @@
+package define
+
+//digest algorithm
+const (
+	DigestOfMd5 = iota
+	DigestOfSha256
+)
@@ -1,12 +1,25 @@
 package define
 
 //message id
+//values are part of wire protocol, never reorder or reuse them
 const (
-	MessageIdOfNone = iota
-	MessageIdOfRead
-	MessageIdOfMultiRead
-	MessageIdOfWrite
-	MessageIdOfRemove
-	MessageIdOfDelete
-	MessageIdOfListFile
+	MessageIdOfNone = 0
+	MessageIdOfRead = 1
+	MessageIdOfMultiRead = 2
+	MessageIdOfWrite = 3
+	MessageIdOfRemove = 4
+	MessageIdOfDelete = 5
+	MessageIdOfListFile = 6
+	MessageIdOfLookupDigest = 7
+	MessageIdOfHandshake = 8
+	MessageIdOfUploadStart = 9
+	MessageIdOfUploadPart = 10
+	MessageIdOfUploadStatus = 11
+	MessageIdOfUploadCommit = 12
+)
+
+//custom message id range for server extensions
+const (
+	MessageIdOfCustomMin = 1000
+	MessageIdOfCustomMax = 1 << 30
 )
@@ -0,0 +1,87 @@
+package define
+
+import (
+	"testing"
+)
+
+/*
+ * wire value test
+ * - message ids and error codes keep their values
+ * - message ids are unique and out of custom range
+ */
+
+//locked message ids
+var lockedMessageIds = map[string]int32{
+	"none": MessageIdOfNone,
+	"read": MessageIdOfRead,
+	"multiRead": MessageIdOfMultiRead,
+	"write": MessageIdOfWrite,
+	"remove": MessageIdOfRemove,
+	"delete": MessageIdOfDelete,
+	"listFile": MessageIdOfListFile,
+	"lookupDigest": MessageIdOfLookupDigest,
+	"handshake": MessageIdOfHandshake,
+	"uploadStart": MessageIdOfUploadStart,
+	"uploadPart": MessageIdOfUploadPart,
+	"uploadStatus": MessageIdOfUploadStatus,
+	"uploadCommit": MessageIdOfUploadCommit,
+}
+
+func TestMessageIdLocked(t *testing.T) {
+	expects := map[string]int32{
+		"none": 0,
+		"read": 1,
+		"multiRead": 2,
+		"write": 3,
+		"remove": 4,
+		"delete": 5,
+		"listFile": 6,
+		"lookupDigest": 7,
+		"handshake": 8,
+		"uploadStart": 9,
+		"uploadPart": 10,
+		"uploadStatus": 11,
+		"uploadCommit": 12,
+	}
+	if len(expects) != len(lockedMessageIds) {
+		t.Fatalf("expect %v message ids, got %v", len(expects), len(lockedMessageIds))
+	}
+	for name, id := range lockedMessageIds {
+		if expect, ok := expects[name]; !ok || id != expect {
+			t.Fatalf("message id of %v changed, expect %v, got %v", name, expect, id)
+		}
+	}
+	if MessageIdOfCustomMin != 1000 || MessageIdOfCustomMax != 1 << 30 {
+		t.Fatalf("custom range changed, [%v, %v]", MessageIdOfCustomMin, MessageIdOfCustomMax)
+	}
+}
+
+func TestMessageIdUnique(t *testing.T) {
+	names := map[int32]string{}
+	for name, id := range lockedMessageIds {
+		if old, ok := names[id]; ok {
+			t.Fatalf("message id %v used by %v and %v", id, old, name)
+		}
+		names[id] = name
+		if id >= MessageIdOfCustomMin {
+			t.Fatalf("message id of %v in custom range", name)
+		}
+	}
+}
+
+func TestErrCodeLocked(t *testing.T) {
+	codes := []int{
+		ErrCodeOfSucceed,
+		ErrCodeOfInvalidPara,
+		ErrCodeOfInterError,
+		ErrCodeOfNodeDown,
+		ErrCodeOfNoSuchData,
+		ErrCodeOfNoCallBack,
+		ErrCodeOfRunError,
+	}
+	for i, code := range codes {
+		if code != i {
+			t.Fatalf("error code %v changed to %v", i, code)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package define
+
+//protocol version
+const (
+	ProtocolVersion = 1
+)
+
+//capability
+const (
+	CapOfRead = "read"
+	CapOfMultiRead = "multiRead"
+	CapOfWrite = "write"
+	CapOfRemove = "remove"
+	CapOfDelete = "delete"
+	CapOfListFile = "listFile"
+	CapOfLookupDigest = "lookupDigest"
+	CapOfRawFrame = "rawFrame"
+	CapOfChunkUpload = "chunkUpload"
+	CapOfSharedUpload = "sharedUpload" //upload session shared by all masters
+)
+
+//capabilities of server without handshake
+var BaseCapabilities = []string{
+	CapOfRead,
+	CapOfMultiRead,
+	CapOfWrite,
+	CapOfRemove,
+	CapOfDelete,
+	CapOfListFile,
+}
+
+//capabilities of this client
+var ClientCapabilities = []string{
+	CapOfRead,
+	CapOfMultiRead,
+	CapOfWrite,
+	CapOfRemove,
+	CapOfDelete,
+	CapOfListFile,
+	CapOfLookupDigest,
+	CapOfRawFrame,
+	CapOfChunkUpload,
+	CapOfSharedUpload,
+}
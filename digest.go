@@ -0,0 +1,176 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+)
+
+/*
+ * end-to-end digest verification
+ * - md5 always computed on write, sha256 optional
+ * - full file reads verified against stored digest
+ */
+
+//checksum mismatch error
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+//typed checksum error, unwrap to ErrChecksumMismatch
+type ChecksumError struct {
+	ShortUrl string
+	Algo string
+	Expect string
+	Actual string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch, shortUrl:%v, algo:%v, expect:%v, actual:%v",
+		e.ShortUrl, e.Algo, e.Expect, e.Actual)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+//set digest algorithm, DigestOfMd5 or DigestOfSha256
+//md5 is always computed, sha256 is sent and verified in addition
+func (f *Client) SetDigestAlgo(algo int) error {
+	if algo != define.DigestOfMd5 && algo != define.DigestOfSha256 {
+		return errors.New("invalid digest algorithm")
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.digestAlgo = algo
+	return nil
+}
+
+////////////////
+//private func
+////////////////
+
+//fill digest of write request
+func (f *Client) fillDigest(req *json.WriteFileReqJson) error {
+	f.RLock()
+	algo := f.digestAlgo
+	f.RUnlock()
+
+	//md5 always computed
+	md5Str := face.Md5Hex(req.Data)
+	if req.Md5 != "" && req.Md5 != md5Str {
+		return &ChecksumError{
+			ShortUrl: req.Name,
+			Algo: "md5",
+			Expect: req.Md5,
+			Actual: md5Str,
+		}
+	}
+	req.Md5 = md5Str
+	if algo != define.DigestOfSha256 {
+		return nil
+	}
+	shaStr := face.Sha256Hex(req.Data)
+	if req.Sha256 != "" && req.Sha256 != shaStr {
+		return &ChecksumError{
+			ShortUrl: req.Name,
+			Algo: "sha256",
+			Expect: req.Sha256,
+			Actual: shaStr,
+		}
+	}
+	req.Sha256 = shaStr
+	return nil
+}
+
+//verify full file read against stored digest
+//skip if server didn't return any digest
+func (f *Client) verifyDigest(
+		shortUrl string,
+		resp *json.ReadFileRespJson,
+	) error {
+	if resp == nil {
+		return nil
+	}
+	f.RLock()
+	algo := f.digestAlgo
+	f.RUnlock()
+	if algo == define.DigestOfSha256 && resp.Sha256 != "" {
+		actual := face.Sha256Hex(resp.Data)
+		if actual != resp.Sha256 {
+			return &ChecksumError{
+				ShortUrl: shortUrl,
+				Algo: "sha256",
+				Expect: resp.Sha256,
+				Actual: actual,
+			}
+		}
+		return nil
+	}
+	if resp.Md5 != "" {
+		actual := face.Md5Hex(resp.Data)
+		if actual != resp.Md5 {
+			return &ChecksumError{
+				ShortUrl: shortUrl,
+				Algo: "md5",
+				Expect: resp.Md5,
+				Actual: actual,
+			}
+		}
+	}
+	return nil
+}
+
+//verify multi read files
+//mismatched file retry once on different node
+func (f *Client) verifyMultiFiles(
+		ctx context.Context,
+		node *face.OneNode,
+		files map[string]*json.ReadFileRespJson,
+	) map[string]error {
+	errMap := map[string]error{}
+	for shortUrl, file := range files {
+		err := f.verifyDigest(shortUrl, file)
+		if err == nil {
+			continue
+		}
+		f.getLogger().Warn("tinyfs read checksum mismatch, retry on other node",
+			LogKeyOfOp, opOfMultiRead.name,
+			LogKeyOfNode, node.Address,
+			LogKeyOfShortUrl, shortUrl,
+			LogKeyOfErr, err)
+		file, err = f.retryVerifiedRead(ctx, node, &json.ReadFileReqJson{ShortUrl: shortUrl}, err)
+		if err != nil {
+			errMap[shortUrl] = err
+			continue
+		}
+		files[shortUrl] = file
+	}
+	return errMap
+}
+
+//retry read once on different node after checksum mismatch
+//return origin error if no other node
+func (f *Client) retryVerifiedRead(
+		ctx context.Context,
+		node *face.OneNode,
+		req *json.ReadFileReqJson,
+		originErr error,
+	) (*json.ReadFileRespJson, error) {
+	para := &callPara{
+		excludeTags: []string{node.Tag},
+	}
+	resp, err := do(ctx, f, opOfRead, req, json.NewReadFileRespJson, para)
+	if errors.Is(err, face.ErrNoNode) {
+		return nil, originErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = f.verifyDigest(req.ShortUrl, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
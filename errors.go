@@ -0,0 +1,125 @@
+package tinyfs_client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"sort"
+	"strings"
+)
+
+/*
+ * client errors
+ * - server error code mapped into CodeError
+ * - CodeError matches sentinel errors by errors.Is
+ */
+
+//sentinel errors
+var (
+	ErrInvalidPara = errors.New("invalid parameter")
+	ErrNoSuchData = errors.New("no such data")
+	ErrNodeDown = errors.New("node down")
+	ErrServerInter = errors.New("server inter error")
+	ErrUnsupported = errors.New("operation not supported by server")
+	ErrPanic = errors.New("request panic")
+	ErrUnexpectedResp = errors.New("unexpected response type")
+	ErrRateLimited = face.ErrRateLimited
+)
+
+//server error code error
+type CodeError struct {
+	Op string
+	Code int32
+	Msg string
+}
+
+func (e *CodeError) Error() string {
+	return fmt.Sprintf("%v failed, code:%v, err:%v", e.Op, e.Code, e.Msg)
+}
+
+//match sentinel errors
+func (e *CodeError) Is(target error) bool {
+	switch e.Code {
+	case define.ErrCodeOfInvalidPara:
+		return target == ErrInvalidPara
+	case define.ErrCodeOfNoSuchData:
+		return target == ErrNoSuchData
+	case define.ErrCodeOfNodeDown:
+		return target == ErrNodeDown
+	case define.ErrCodeOfInterError, define.ErrCodeOfRunError:
+		return target == ErrServerInter
+	case define.ErrCodeOfNoCallBack:
+		return target == ErrUnsupported
+	}
+	return false
+}
+
+//transport error, request may not reach server
+type TransportError struct {
+	Op string
+	Addr string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%v send to %v failed, %v", e.Op, e.Addr, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+//response type error, interceptor returned wrong type
+type RespTypeError struct {
+	Op string
+	Expect string
+	Actual string
+}
+
+func (e *RespTypeError) Error() string {
+	return fmt.Sprintf("%v response type %v, expect %v", e.Op, e.Actual, e.Expect)
+}
+
+func (e *RespTypeError) Unwrap() error {
+	return ErrUnexpectedResp
+}
+
+//multi file read error, keyed by short url
+//matches errors of all files by errors.Is and errors.As
+type MultiReadError struct {
+	Errs map[string]error
+}
+
+func (e *MultiReadError) Error() string {
+	shortUrls := make([]string, 0, len(e.Errs))
+	for shortUrl := range e.Errs {
+		shortUrls = append(shortUrls, shortUrl)
+	}
+	sort.Strings(shortUrls)
+	msgs := make([]string, 0, len(shortUrls))
+	for _, shortUrl := range shortUrls {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", shortUrl, e.Errs[shortUrl]))
+	}
+	return fmt.Sprintf("read %v files failed, %v", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+func (e *MultiReadError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+//gen error by response code, nil if succeed
+func codeError(op string, code int32, msg string) error {
+	if code == define.ErrCodeOfSucceed {
+		return nil
+	}
+	return &CodeError{
+		Op: op,
+		Code: code,
+		Msg: msg,
+	}
+}
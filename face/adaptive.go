@@ -0,0 +1,232 @@
+package face
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+ * adaptive concurrency limiter face
+ * - per node in-flight limit, adjusted by observed samples
+ * - additive increase of one per round trip while node keeps up
+ * - multiplicative decrease on overload error or latency rise over baseline,
+ *   at most once for requests sent before last decrease
+ * - baseline is min latency of recent window, in the style of vegas
+ * - sample without latency adjusts limit by overload only
+ */
+const (
+	DefaultAdaptiveInitLimit = 20
+	DefaultAdaptiveMinLimit = 1
+	DefaultAdaptiveMaxLimit = 200
+	DefaultAdaptiveBackoff = 0.9
+	DefaultAdaptiveTolerance = 2.0
+	DefaultAdaptiveRttWindow = time.Second * 30
+)
+
+//adaptive limit para
+type AdaptivePara struct {
+	InitLimit int
+	MinLimit int
+	MaxLimit int
+	Backoff float64 //decrease ratio on overload, in (0, 1)
+	Tolerance float64 //latency over baseline * tolerance means overload
+	RttWindow time.Duration //baseline latency reset window
+	FailFast bool //fail with ErrRateLimited instead of blocking
+}
+
+//limit of one node
+type adaptiveLimit struct {
+	limit float64
+	inFlight int
+	minRtt time.Duration
+	minRttAt time.Time
+	decreaseAt time.Time //last decrease time
+	waitChan chan struct{} //closed when one slot released
+	sync.Mutex
+}
+
+//face info
+type AdaptiveLimiter struct {
+	para *AdaptivePara
+	limits sync.Map //tag -> *adaptiveLimit
+}
+
+//construct
+func NewAdaptiveLimiter(para *AdaptivePara) *AdaptiveLimiter {
+	if para == nil {
+		para = &AdaptivePara{}
+	}
+	if para.MinLimit <= 0 {
+		para.MinLimit = DefaultAdaptiveMinLimit
+	}
+	if para.MaxLimit <= 0 {
+		para.MaxLimit = DefaultAdaptiveMaxLimit
+	}
+	if para.MaxLimit < para.MinLimit {
+		para.MaxLimit = para.MinLimit
+	}
+	if para.InitLimit <= 0 {
+		para.InitLimit = DefaultAdaptiveInitLimit
+	}
+	if para.InitLimit < para.MinLimit {
+		para.InitLimit = para.MinLimit
+	}
+	if para.InitLimit > para.MaxLimit {
+		para.InitLimit = para.MaxLimit
+	}
+	if para.Backoff <= 0 || para.Backoff >= 1 {
+		para.Backoff = DefaultAdaptiveBackoff
+	}
+	if para.Tolerance <= 1 {
+		para.Tolerance = DefaultAdaptiveTolerance
+	}
+	if para.RttWindow <= 0 {
+		para.RttWindow = DefaultAdaptiveRttWindow
+	}
+	this := &AdaptiveLimiter{
+		para: para,
+	}
+	return this
+}
+
+//acquire one slot of node
+//block until slot released or context done, unless fail fast
+func (f *AdaptiveLimiter) Acquire(ctx context.Context, tag string) error {
+	l := f.getOrInitLimit(tag)
+	for {
+		l.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.Unlock()
+			return nil
+		}
+		if f.para.FailFast {
+			l.Unlock()
+			return ErrRateLimited
+		}
+		waitChan := l.waitChan
+		l.Unlock()
+		select {
+		case <- waitChan:
+		case <- ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+//release one slot of node and adjust limit by sample
+//zero rtt means no latency sample, like payload request
+//skipped if node limit dropped after acquired
+func (f *AdaptiveLimiter) Done(tag string, rtt time.Duration, overload bool) {
+	l := f.getLimit(tag)
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	inFlight := l.inFlight
+	l.release()
+
+	//update baseline latency
+	now := time.Now()
+	if rtt > 0 && (l.minRtt <= 0 || rtt < l.minRtt || now.Sub(l.minRttAt) > f.para.RttWindow) {
+		l.minRtt = rtt
+		l.minRttAt = now
+	}
+
+	//adjust limit
+	if overload || (rtt > 0 && float64(rtt) > float64(l.minRtt) * f.para.Tolerance) {
+		sentAt := now.Add(-rtt)
+		if rtt <= 0 {
+			//no latency sample, assume one baseline round trip
+			sentAt = now.Add(-l.minRtt)
+		}
+		if sentAt.Before(l.decreaseAt) {
+			//sent before last decrease, already counted
+			return
+		}
+		l.limit = math.Max(float64(f.para.MinLimit), l.limit * f.para.Backoff)
+		l.decreaseAt = now
+		return
+	}
+	if inFlight * 2 >= int(l.limit) {
+		//only grow when limit is really used
+		l.limit = math.Min(float64(f.para.MaxLimit), l.limit + 1 / l.limit)
+	}
+}
+
+//release one slot of node without sample
+//for canceled request, or request ended by caller deadline
+func (f *AdaptiveLimiter) Cancel(tag string) {
+	l := f.getLimit(tag)
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.release()
+}
+
+//drop limits of tags not in live tags
+//called after node removed
+func (f *AdaptiveLimiter) RetainNodes(tags []string) {
+	live := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		live[tag] = true
+	}
+	sf := func(k, v interface{}) bool {
+		tag, _ := k.(string)
+		if !live[tag] {
+			f.limits.Delete(k)
+		}
+		return true
+	}
+	f.limits.Range(sf)
+}
+
+//get current limit of node, init limit if node not used yet
+func (f *AdaptiveLimiter) GetLimit(tag string) int {
+	l := f.getLimit(tag)
+	if l == nil {
+		return f.para.InitLimit
+	}
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit)
+}
+
+////////////////
+//private func
+////////////////
+
+//get limit of node, nil if not exists
+func (f *AdaptiveLimiter) getLimit(tag string) *adaptiveLimit {
+	v, ok := f.limits.Load(tag)
+	if !ok {
+		return nil
+	}
+	l, _ := v.(*adaptiveLimit)
+	return l
+}
+
+//get or init limit of node, only for acquire
+func (f *AdaptiveLimiter) getOrInitLimit(tag string) *adaptiveLimit {
+	v, ok := f.limits.Load(tag)
+	if !ok {
+		v, _ = f.limits.LoadOrStore(tag, &adaptiveLimit{
+			limit: float64(f.para.InitLimit),
+			waitChan: make(chan struct{}),
+		})
+	}
+	l, _ := v.(*adaptiveLimit)
+	return l
+}
+
+//release one slot and wake up waiters, run in locker
+func (l *adaptiveLimit) release() {
+	l.inFlight--
+	close(l.waitChan)
+	l.waitChan = make(chan struct{})
+}
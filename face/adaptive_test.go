@@ -0,0 +1,151 @@
+package face
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+ * simulation for adaptive concurrency limit
+ * - slow server keeps fixed latency until capacity is reached
+ * - over capacity, latency grows with queued requests and inter errors returned
+ * - limit should settle where latency rises over tolerance,
+ *   above capacity but below the failure point
+ */
+const (
+	simCapacity = 16
+	simLatency = time.Millisecond * 5
+	simErrorQueue = 64 //queued requests over which server fails
+	simWorkers = 200
+	simDuration = time.Second * 2
+	simTag = "slow"
+)
+
+//simulated slow server
+type slowServer struct {
+	inFlight int64
+}
+
+//handle one request, return cost and overload flag
+func (s *slowServer) handle() (time.Duration, bool) {
+	current := atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
+	cost := simLatency
+	if current > simCapacity {
+		//queued requests wait for capacity
+		cost = simLatency * time.Duration(current) / simCapacity
+	}
+	time.Sleep(cost)
+	return cost, current > simErrorQueue
+}
+
+func TestAdaptiveLimitSettles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip simulation in short mode")
+	}
+	var (
+		requests, overloads int64
+		wg sync.WaitGroup
+	)
+	limiter := NewAdaptiveLimiter(&AdaptivePara{
+		InitLimit: 100,
+		Tolerance: 1.5,
+	})
+	server := &slowServer{}
+	ctx, cancel := context.WithTimeout(context.Background(), simDuration)
+	defer cancel()
+
+	//run workers
+	for i := 0; i < simWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := limiter.Acquire(ctx, simTag); err != nil {
+					return
+				}
+				cost, overload := server.handle()
+				limiter.Done(simTag, cost, overload)
+				atomic.AddInt64(&requests, 1)
+				if overload {
+					atomic.AddInt64(&overloads, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	limit := limiter.GetLimit(simTag)
+	t.Logf("limit:%v, capacity:%v, requests:%v, overloads:%v",
+		limit, simCapacity, requests, overloads)
+	if limit < simCapacity || limit > simErrorQueue {
+		t.Fatalf("limit %v not settled in [%v, %v]", limit, simCapacity, simErrorQueue)
+	}
+}
+
+func TestAdaptiveLimitPayloadSample(t *testing.T) {
+	limiter := NewAdaptiveLimiter(&AdaptivePara{
+		InitLimit: 10,
+	})
+	ctx := context.Background()
+
+	//payload samples carry no latency, slow ones never decrease limit
+	for i := 0; i < 10; i++ {
+		if err := limiter.Acquire(ctx, simTag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		limiter.Done(simTag, 0, false)
+	}
+	if limit := limiter.GetLimit(simTag); limit < 10 {
+		t.Fatalf("limit %v decreased by payload samples", limit)
+	}
+
+	//overload still decreases limit
+	if err := limiter.Acquire(ctx, simTag); err != nil {
+		t.Fatal(err)
+	}
+	limiter.Done(simTag, 0, true)
+	if limit := limiter.GetLimit(simTag); limit >= 10 {
+		t.Fatalf("limit %v not decreased by overload", limit)
+	}
+
+	//canceled request releases slot only
+	before := limiter.GetLimit(simTag)
+	if err := limiter.Acquire(ctx, simTag); err != nil {
+		t.Fatal(err)
+	}
+	limiter.Cancel(simTag)
+	if limit := limiter.GetLimit(simTag); limit != before {
+		t.Fatalf("limit %v changed by canceled request, expect %v", limit, before)
+	}
+}
+
+func TestAdaptiveLimitNoEntry(t *testing.T) {
+	limiter := NewAdaptiveLimiter(&AdaptivePara{
+		InitLimit: 10,
+	})
+
+	//read of unknown node creates nothing
+	if limit := limiter.GetLimit("unknown"); limit != 10 {
+		t.Fatalf("limit of unknown node %v", limit)
+	}
+	if _, ok := limiter.limits.Load("unknown"); ok {
+		t.Fatal("entry created by read")
+	}
+
+	//release after node dropped creates nothing
+	if err := limiter.Acquire(context.Background(), simTag); err != nil {
+		t.Fatal(err)
+	}
+	limiter.RetainNodes(nil)
+	limiter.Done(simTag, time.Millisecond, false)
+	limiter.Cancel(simTag)
+	if _, ok := limiter.limits.Load(simTag); ok {
+		t.Fatal("entry created by release")
+	}
+}
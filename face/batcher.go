@@ -0,0 +1,221 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * read batcher face
+ * - collect single reads for a short window
+ * - send them as one multi read request
+ * - fan the results back out to the waiting callers
+ * - batch request keeps values of first caller, like trace parent
+ */
+const (
+	DefaultBatchWindow = time.Millisecond * 2
+	DefaultBatchMaxKeys = 64
+	DefaultBatchMaxBytes = 1024 * 4 //4KB
+)
+
+//batch para
+type BatchPara struct {
+	Window time.Duration //max wait before flush
+	MaxKeys int //max short urls per batch
+	MaxBytes int //max bytes of short urls per batch
+}
+
+//batch read func, send multi read request
+//errMap hold failed files which should not fan out as succeed
+type BatchReadFunc func(ctx context.Context, shortUrls []string) (
+	files map[string]*json.ReadFileRespJson, errMap map[string]error, err error)
+
+//one waiting call
+type batchCall struct {
+	shortUrl string
+	ctx context.Context
+	resultChan chan batchResult
+}
+
+//one call result
+type batchResult struct {
+	resp *json.ReadFileRespJson
+	err error
+}
+
+//face info
+type Batcher struct {
+	para *BatchPara
+	cb BatchReadFunc
+	pending []*batchCall
+	pendingBytes int
+	timer *time.Timer
+	sync.Mutex
+}
+
+//construct
+func NewBatcher(para *BatchPara, cb BatchReadFunc) *Batcher {
+	if para == nil {
+		para = &BatchPara{}
+	}
+	if para.Window <= 0 {
+		para.Window = DefaultBatchWindow
+	}
+	if para.MaxKeys <= 0 {
+		para.MaxKeys = DefaultBatchMaxKeys
+	}
+	if para.MaxBytes <= 0 {
+		para.MaxBytes = DefaultBatchMaxBytes
+	}
+	this := &Batcher{
+		para: para,
+		cb: cb,
+		pending: []*batchCall{},
+	}
+	return this
+}
+
+//quit, flush pending calls
+func (f *Batcher) Quit() {
+	f.flush()
+}
+
+//read one file by batch
+func (f *Batcher) Read(
+		ctx context.Context,
+		shortUrl string,
+	) (*json.ReadFileRespJson, error) {
+	//check
+	if shortUrl == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	if f.cb == nil {
+		return nil, errors.New("batch read func not setup")
+	}
+
+	//add into pending
+	call := &batchCall{
+		shortUrl: shortUrl,
+		ctx: ctx,
+		resultChan: make(chan batchResult, 1),
+	}
+	f.addCall(call)
+
+	//wait result or caller cancel
+	select {
+	case result := <- call.resultChan:
+		return result.resp, result.err
+	case <- ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+////////////////
+//private func
+////////////////
+
+//add one call, flush when batch is full
+func (f *Batcher) addCall(call *batchCall) {
+	var (
+		batch []*batchCall
+	)
+	f.Lock()
+	f.pending = append(f.pending, call)
+	f.pendingBytes += len(call.shortUrl)
+	if len(f.pending) >= f.para.MaxKeys || f.pendingBytes >= f.para.MaxBytes {
+		//batch is full
+		batch = f.takePending()
+	}else if f.timer == nil {
+		//first call, start window timer
+		f.timer = time.AfterFunc(f.para.Window, f.flush)
+	}
+	f.Unlock()
+
+	if batch != nil {
+		go f.runBatch(batch)
+	}
+}
+
+//flush pending calls
+func (f *Batcher) flush() {
+	f.Lock()
+	batch := f.takePending()
+	f.Unlock()
+	if len(batch) > 0 {
+		f.runBatch(batch)
+	}
+}
+
+//take pending calls, run in locker
+func (f *Batcher) takePending() []*batchCall {
+	batch := f.pending
+	f.pending = []*batchCall{}
+	f.pendingBytes = 0
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	return batch
+}
+
+//send one batch and fan out results
+func (f *Batcher) runBatch(batch []*batchCall) {
+	var (
+		calls []*batchCall
+		shortUrls []string
+	)
+	//skip canceled callers and duplicate short urls
+	urlMap := map[string]bool{}
+	for _, call := range batch {
+		if call.ctx.Err() != nil {
+			continue
+		}
+		calls = append(calls, call)
+		if !urlMap[call.shortUrl] {
+			urlMap[call.shortUrl] = true
+			shortUrls = append(shortUrls, call.shortUrl)
+		}
+	}
+	if len(calls) <= 0 {
+		return
+	}
+
+	//cancel batch request when all callers gave up
+	batchCtx, cancel := context.WithCancel(context.WithoutCancel(calls[0].ctx))
+	defer cancel()
+	left := int32(len(calls))
+	for _, call := range calls {
+		go func(c *batchCall) {
+			select {
+			case <- c.ctx.Done():
+				if atomic.AddInt32(&left, -1) <= 0 {
+					cancel()
+				}
+			case <- batchCtx.Done():
+			}
+		}(call)
+	}
+
+	//send multi read request
+	files, errMap, err := f.cb(batchCtx, shortUrls)
+
+	//fan out results
+	for _, call := range calls {
+		result := batchResult{err: err}
+		if err == nil {
+			file, ok := files[call.shortUrl]
+			if subErr, hasErr := errMap[call.shortUrl]; hasErr {
+				result.err = subErr
+			}else if !ok || file == nil {
+				result.err = errors.New("no such file")
+			}else{
+				result.resp = file
+			}
+		}
+		call.resultChan <- result
+	}
+}
@@ -0,0 +1,201 @@
+package face
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/json"
+	"sync"
+	"time"
+)
+
+/*
+ * memory cache face
+ * - lru eviction with byte size budget
+ * - per entry ttl
+ * - short url files are immutable after write
+ * - entries keyed by caller packet meta too, never shared across meta
+ */
+const (
+	DefaultCacheMaxBytes = 1024 * 1024 * 64 //64MB
+	DefaultCacheTTL = time.Minute * 10
+)
+
+//memory cache para
+type MemCachePara struct {
+	MaxBytes int64 //byte size budget
+	TTL time.Duration //per entry ttl
+}
+
+//cache stat info
+type CacheStat struct {
+	Hits int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries int `json:"entries"`
+	Bytes int64 `json:"bytes"`
+}
+
+//one cache entry
+type cacheEntry struct {
+	key string
+	shortUrl string
+	resp *json.ReadFileRespJson
+	size int64
+	expireAt time.Time
+}
+
+//face info
+type MemCache struct {
+	para *MemCachePara
+	lruList *list.List //front is newest
+	items map[string]*list.Element //key -> element
+	urlKeys map[string]map[string]bool //short url -> keys
+	bytes int64
+	stat CacheStat
+	sync.Mutex
+}
+
+//construct
+func NewMemCache(para *MemCachePara) *MemCache {
+	if para == nil {
+		para = &MemCachePara{}
+	}
+	if para.MaxBytes <= 0 {
+		para.MaxBytes = DefaultCacheMaxBytes
+	}
+	if para.TTL <= 0 {
+		para.TTL = DefaultCacheTTL
+	}
+	this := &MemCache{
+		para: para,
+		lruList: list.New(),
+		items: map[string]*list.Element{},
+		urlKeys: map[string]map[string]bool{},
+	}
+	return this
+}
+
+//gen cache key
+func CacheKey(shortUrl string, start, end int64) string {
+	return fmt.Sprintf("%v:%v:%v", shortUrl, start, end)
+}
+
+//get cached file, meta is packet meta key of caller
+//the result is shared, don't modify it
+func (f *MemCache) Get(
+		shortUrl string,
+		start, end int64,
+		meta string,
+	) (*json.ReadFileRespJson, bool) {
+	key := CacheKey(shortUrl, start, end) + meta
+	f.Lock()
+	defer f.Unlock()
+	elem, ok := f.items[key]
+	if !ok {
+		f.stat.Misses++
+		return nil, false
+	}
+	entry, _ := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expireAt) {
+		//expired
+		f.removeElement(elem)
+		f.stat.Misses++
+		return nil, false
+	}
+	f.lruList.MoveToFront(elem)
+	f.stat.Hits++
+	return entry.resp, true
+}
+
+//set cached file, meta is packet meta key of caller
+func (f *MemCache) Set(
+		shortUrl string,
+		start, end int64,
+		meta string,
+		resp *json.ReadFileRespJson,
+	) {
+	//check
+	if shortUrl == "" || resp == nil {
+		return
+	}
+	size := int64(len(resp.Data) + len(resp.Name) + len(resp.Type) + len(shortUrl))
+	if size > f.para.MaxBytes {
+		//too large for cache
+		return
+	}
+	key := CacheKey(shortUrl, start, end) + meta
+
+	f.Lock()
+	defer f.Unlock()
+	if elem, ok := f.items[key]; ok {
+		f.removeElement(elem)
+	}
+
+	//add new entry
+	entry := &cacheEntry{
+		key: key,
+		shortUrl: shortUrl,
+		resp: resp,
+		size: size,
+		expireAt: time.Now().Add(f.para.TTL),
+	}
+	f.items[key] = f.lruList.PushFront(entry)
+	keys, ok := f.urlKeys[shortUrl]
+	if !ok {
+		keys = map[string]bool{}
+		f.urlKeys[shortUrl] = keys
+	}
+	keys[key] = true
+	f.bytes += size
+
+	//evict oldest entries
+	for f.bytes > f.para.MaxBytes {
+		elem := f.lruList.Back()
+		if elem == nil {
+			break
+		}
+		f.removeElement(elem)
+		f.stat.Evictions++
+	}
+}
+
+//del cached files by short urls, include all ranges
+func (f *MemCache) Del(shortUrls ...string) {
+	f.Lock()
+	defer f.Unlock()
+	for _, shortUrl := range shortUrls {
+		for key := range f.urlKeys[shortUrl] {
+			if elem, ok := f.items[key]; ok {
+				f.removeElement(elem)
+			}
+		}
+	}
+}
+
+//get stat info
+func (f *MemCache) GetStat() CacheStat {
+	f.Lock()
+	defer f.Unlock()
+	stat := f.stat
+	stat.Entries = len(f.items)
+	stat.Bytes = f.bytes
+	return stat
+}
+
+////////////////
+//private func
+////////////////
+
+//remove one element, run in locker
+func (f *MemCache) removeElement(elem *list.Element) {
+	entry, _ := elem.Value.(*cacheEntry)
+	f.lruList.Remove(elem)
+	delete(f.items, entry.key)
+	if keys, ok := f.urlKeys[entry.shortUrl]; ok {
+		delete(keys, entry.key)
+		if len(keys) <= 0 {
+			delete(f.urlKeys, entry.shortUrl)
+		}
+	}
+	f.bytes -= entry.size
+}
@@ -0,0 +1,33 @@
+package face
+
+import (
+	"github.com/andyzhou/tinyfs_client/json"
+	"testing"
+)
+
+/*
+ * memory cache test
+ * - entries of different caller meta never shared
+ * - del by short url removes entries of all meta
+ */
+
+func TestMemCacheMeta(t *testing.T) {
+	cache := NewMemCache(nil)
+	resp := json.NewReadFileRespJson()
+	resp.Data = []byte("hello")
+	cache.Set("s1", 0, 0, "|tenant=a", resp)
+	if _, ok := cache.Get("s1", 0, 0, "|tenant=a"); !ok {
+		t.Fatal("entry of same meta missed")
+	}
+	if _, ok := cache.Get("s1", 0, 0, "|tenant=b"); ok {
+		t.Fatal("entry shared with other meta")
+	}
+	if _, ok := cache.Get("s1", 0, 0, ""); ok {
+		t.Fatal("entry shared with caller without meta")
+	}
+	cache.Set("s1", 0, 0, "", resp)
+	cache.Del("s1")
+	if stat := cache.GetStat(); stat.Entries != 0 {
+		t.Fatalf("entries kept after del, %v", stat.Entries)
+	}
+}
@@ -0,0 +1,451 @@
+package face
+
+import (
+	"container/list"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * disk cache face
+ * - persistent tier behind memory cache, survive process restart
+ * - only full file reads are cached
+ * - one entry is data file and meta file of json.FileInfo
+ * - write with temp file and rename, md5 validated on set, load and get
+ * - md5 of server checked before stored, mismatched data never cached
+ * - corrupted entries are cleaned up on startup
+ * - entry files read and written outside locker, renamed under locker
+ * - async write by few writers
+ */
+const (
+	DefaultDiskCacheMaxBytes = 1024 * 1024 * 1024 //1GB
+	DefaultDiskCacheWriters = 4 //async writes at same time
+	DiskCacheDataExt = ".data"
+	DiskCacheMetaExt = ".meta"
+	DiskCacheTempPrefix = ".tmp-"
+)
+
+//disk cache para
+type DiskCachePara struct {
+	Dir string //cache root dir
+	MaxBytes int64 //byte size budget
+}
+
+//one disk entry
+type diskEntry struct {
+	name string //file base name
+	shortUrl string
+	size int64
+}
+
+//face info
+type DiskCache struct {
+	para *DiskCachePara
+	lruList *list.List //front is newest
+	items map[string]*list.Element //short url -> element
+	bytes int64
+	stat CacheStat
+	delSeq int64 //inc by every del, async write skipped if changed
+	writers chan struct{} //async writer slots
+	sync.Mutex
+}
+
+//construct
+func NewDiskCache(para *DiskCachePara) (*DiskCache, error) {
+	//check
+	if para == nil || para.Dir == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	if para.MaxBytes <= 0 {
+		para.MaxBytes = DefaultDiskCacheMaxBytes
+	}
+	err := os.MkdirAll(para.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	this := &DiskCache{
+		para: para,
+		lruList: list.New(),
+		items: map[string]*list.Element{},
+		writers: make(chan struct{}, DefaultDiskCacheWriters),
+	}
+	err = this.load()
+	if err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+//get cached file
+//entry read and md5 validated outside locker
+func (f *DiskCache) Get(shortUrl string) (*json.ReadFileRespJson, bool) {
+	f.Lock()
+	elem, ok := f.items[shortUrl]
+	if !ok {
+		f.stat.Misses++
+		f.Unlock()
+		return nil, false
+	}
+	entry, _ := elem.Value.(*diskEntry)
+	f.lruList.MoveToFront(elem)
+	f.Unlock()
+
+	//read entry with md5 check, file may be changed on disk
+	info, data, err := f.readEntry(entry.name, true)
+
+	//entry replaced or removed while reading, files may be mixed
+	f.Lock()
+	defer f.Unlock()
+	elem, ok = f.items[shortUrl]
+	if !ok || elem.Value != entry {
+		f.stat.Misses++
+		return nil, false
+	}
+	if err != nil || info.ShortUrl != shortUrl {
+		//corrupted, just remove it
+		f.removeElement(elem)
+		f.stat.Misses++
+		return nil, false
+	}
+	f.stat.Hits++
+
+	//touch entry, keep lru order after restart
+	now := time.Now()
+	os.Chtimes(f.metaPath(entry.name), now, now)
+
+	//format resp
+	resp := json.NewReadFileRespJson()
+	resp.Name = info.Name
+	resp.Type = info.Type
+	resp.Size = info.Size
+	resp.Md5 = info.Md5
+	resp.Sha256 = info.Sha256
+	resp.Data = data
+	return resp, true
+}
+
+//set cached file
+func (f *DiskCache) Set(shortUrl string, resp *json.ReadFileRespJson) error {
+	return f.set(shortUrl, resp, -1)
+}
+
+//set cached file in background, skipped if all writers busy
+//resp data should not be changed after call
+//write skipped if any file deleted after call, deleted file never comes back
+func (f *DiskCache) SetAsync(
+		shortUrl string,
+		resp *json.ReadFileRespJson,
+		cb func(err error),
+	) {
+	f.Lock()
+	delSeq := f.delSeq
+	f.Unlock()
+	select {
+	case f.writers <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() {
+			<- f.writers
+		}()
+		err := f.set(shortUrl, resp, delSeq)
+		if err != nil && cb != nil {
+			cb(err)
+		}
+	}()
+}
+
+//del cached files by short urls
+func (f *DiskCache) Del(shortUrls ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.delSeq++
+	for _, shortUrl := range shortUrls {
+		if elem, ok := f.items[shortUrl]; ok {
+			f.removeElement(elem)
+		}
+	}
+}
+
+//get stat info
+func (f *DiskCache) GetStat() CacheStat {
+	f.Lock()
+	defer f.Unlock()
+	stat := f.stat
+	stat.Entries = len(f.items)
+	stat.Bytes = f.bytes
+	return stat
+}
+
+////////////////
+//private func
+////////////////
+
+//set cached file, negative del seq means always written
+//files written outside locker, renamed and indexed under locker
+func (f *DiskCache) set(
+		shortUrl string,
+		resp *json.ReadFileRespJson,
+		delSeq int64,
+	) error {
+	//check
+	if shortUrl == "" || resp == nil {
+		return errors.New("invalid parameter")
+	}
+	size := int64(len(resp.Data))
+	if size > f.para.MaxBytes {
+		//too large for cache
+		return nil
+	}
+	md5 := Md5Hex(resp.Data)
+	if resp.Md5 != "" && resp.Md5 != md5 {
+		return errors.New("cache data md5 not matched with server")
+	}
+	name := f.entryName(shortUrl)
+
+	//init meta info
+	info := json.NewFileInfo()
+	info.ShortUrl = shortUrl
+	info.Name = resp.Name
+	info.Type = resp.Type
+	info.Size = size
+	info.Md5 = md5
+	info.Sha256 = resp.Sha256
+	info.CreateAt = time.Now().Unix()
+	metaBytes, err := info.Encode(info)
+	if err != nil {
+		return err
+	}
+
+	//write temp files
+	dataTmp, err := writeFileTemp(f.para.Dir, resp.Data)
+	if err != nil {
+		return err
+	}
+	metaTmp, err := writeFileTemp(f.para.Dir, metaBytes)
+	if err != nil {
+		os.Remove(dataTmp)
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if delSeq >= 0 && delSeq != f.delSeq {
+		//file may be deleted after read
+		os.Remove(dataTmp)
+		os.Remove(metaTmp)
+		return nil
+	}
+	if elem, ok := f.items[shortUrl]; ok {
+		f.removeElement(elem)
+	}
+
+	//rename data first, meta file marks entry completed
+	err = os.Rename(dataTmp, f.dataPath(name))
+	if err != nil {
+		os.Remove(dataTmp)
+		os.Remove(metaTmp)
+		return err
+	}
+	err = os.Rename(metaTmp, f.metaPath(name))
+	if err != nil {
+		os.Remove(metaTmp)
+		os.Remove(f.dataPath(name))
+		return err
+	}
+	f.addEntry(&diskEntry{
+		name: name,
+		shortUrl: shortUrl,
+		size: size,
+	})
+	return nil
+}
+
+//load entries from dir, clean up corrupted ones
+func (f *DiskCache) load() error {
+	type loadEntry struct {
+		entry *diskEntry
+		modTime time.Time
+	}
+	var (
+		loaded []*loadEntry
+	)
+	files, err := os.ReadDir(f.para.Dir)
+	if err != nil {
+		return err
+	}
+
+	//collect meta files, remove temp files
+	dataMap := map[string]bool{}
+	for _, file := range files {
+		fileName := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(fileName, DiskCacheTempPrefix) {
+			os.Remove(filepath.Join(f.para.Dir, fileName))
+			continue
+		}
+		if strings.HasSuffix(fileName, DiskCacheDataExt) {
+			dataMap[strings.TrimSuffix(fileName, DiskCacheDataExt)] = true
+			continue
+		}
+		if !strings.HasSuffix(fileName, DiskCacheMetaExt) {
+			continue
+		}
+
+		//validate entry
+		name := strings.TrimSuffix(fileName, DiskCacheMetaExt)
+		info, _, subErr := f.readEntry(name, true)
+		if subErr != nil || f.entryName(info.ShortUrl) != name {
+			f.removeFiles(name)
+			continue
+		}
+		fileInfo, subErr := file.Info()
+		if subErr != nil {
+			f.removeFiles(name)
+			continue
+		}
+		loaded = append(loaded, &loadEntry{
+			entry: &diskEntry{
+				name: name,
+				shortUrl: info.ShortUrl,
+				size: info.Size,
+			},
+			modTime: fileInfo.ModTime(),
+		})
+	}
+
+	//remove data files without meta
+	metaMap := map[string]bool{}
+	for _, v := range loaded {
+		metaMap[v.entry.name] = true
+	}
+	for name := range dataMap {
+		if !metaMap[name] {
+			f.removeFiles(name)
+		}
+	}
+
+	//add entries from oldest to newest
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].modTime.Before(loaded[j].modTime)
+	})
+	f.Lock()
+	defer f.Unlock()
+	for _, v := range loaded {
+		f.addEntry(v.entry)
+	}
+	return nil
+}
+
+//read and validate one entry, md5 checked if verify
+func (f *DiskCache) readEntry(name string, verify bool) (*json.FileInfo, []byte, error) {
+	metaBytes, err := os.ReadFile(f.metaPath(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	info := json.NewFileInfo()
+	err = info.Decode(metaBytes, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(f.dataPath(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) != info.Size {
+		return nil, nil, errors.New("cache entry size not matched")
+	}
+	if verify && Md5Hex(data) != info.Md5 {
+		return nil, nil, errors.New("cache entry md5 not matched")
+	}
+	return info, data, nil
+}
+
+//add entry and evict oldest, run in locker
+func (f *DiskCache) addEntry(entry *diskEntry) {
+	f.items[entry.shortUrl] = f.lruList.PushFront(entry)
+	f.bytes += entry.size
+	for f.bytes > f.para.MaxBytes {
+		elem := f.lruList.Back()
+		if elem == nil {
+			break
+		}
+		f.removeElement(elem)
+		f.stat.Evictions++
+	}
+}
+
+//remove one element and files, run in locker
+func (f *DiskCache) removeElement(elem *list.Element) {
+	entry, _ := elem.Value.(*diskEntry)
+	f.lruList.Remove(elem)
+	delete(f.items, entry.shortUrl)
+	f.bytes -= entry.size
+	f.removeFiles(entry.name)
+}
+
+//remove entry files
+func (f *DiskCache) removeFiles(name string) {
+	os.Remove(f.metaPath(name))
+	os.Remove(f.dataPath(name))
+}
+
+//write file by temp file under dir and rename
+func writeFileAtomic(dir, path string, data []byte) error {
+	tmpPath, err := writeFileTemp(dir, data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+//write data into synced temp file under dir, return temp path
+func writeFileTemp(dir string, data []byte) (string, error) {
+	tmpFile, err := os.CreateTemp(dir, DiskCacheTempPrefix)
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+//gen entry file base name
+func (f *DiskCache) entryName(shortUrl string) string {
+	return Md5Hex([]byte(shortUrl))
+}
+
+//get data file path
+func (f *DiskCache) dataPath(name string) string {
+	return filepath.Join(f.para.Dir, name + DiskCacheDataExt)
+}
+
+//get meta file path
+func (f *DiskCache) metaPath(name string) string {
+	return filepath.Join(f.para.Dir, name + DiskCacheMetaExt)
+}
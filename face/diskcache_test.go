@@ -0,0 +1,91 @@
+package face
+
+import (
+	"github.com/andyzhou/tinyfs_client/json"
+	"os"
+	"testing"
+)
+
+/*
+ * disk cache test
+ * - entry kept with digests of server
+ * - data not matched with server md5 never cached
+ * - entry changed on disk is a miss and removed
+ */
+
+//gen full read resp
+func genDiskCacheResp(data string) *json.ReadFileRespJson {
+	resp := json.NewReadFileRespJson()
+	resp.Name = "a.txt"
+	resp.Type = "text/plain"
+	resp.Size = int64(len(data))
+	resp.Data = []byte(data)
+	resp.Md5 = Md5Hex(resp.Data)
+	resp.Sha256 = "sha"
+	return resp
+}
+
+func TestDiskCacheSetGet(t *testing.T) {
+	cache, err := NewDiskCache(&DiskCachePara{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.Set("s1", genDiskCacheResp("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := cache.Get("s1")
+	if !ok {
+		t.Fatal("cached entry missed")
+	}
+	if string(resp.Data) != "hello" || resp.Md5 != Md5Hex([]byte("hello")) || resp.Sha256 != "sha" {
+		t.Fatalf("cached entry changed, %+v", resp)
+	}
+
+	//reload from dir
+	reloaded, err := NewDiskCache(&DiskCachePara{Dir: cache.para.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = reloaded.Get("s1"); !ok {
+		t.Fatal("entry lost after reload")
+	}
+}
+
+func TestDiskCacheServerMd5(t *testing.T) {
+	cache, err := NewDiskCache(&DiskCachePara{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := genDiskCacheResp("hello")
+	resp.Md5 = Md5Hex([]byte("other"))
+	if err = cache.Set("s1", resp); err == nil {
+		t.Fatal("expect md5 error")
+	}
+	if _, ok := cache.Get("s1"); ok {
+		t.Fatal("mismatched data cached")
+	}
+}
+
+func TestDiskCacheCorrupted(t *testing.T) {
+	cache, err := NewDiskCache(&DiskCachePara{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.Set("s1", genDiskCacheResp("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//same size, other content
+	err = os.WriteFile(cache.dataPath(cache.entryName("s1")), []byte("world"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("s1"); ok {
+		t.Fatal("corrupted entry returned")
+	}
+	if stat := cache.GetStat(); stat.Entries != 0 {
+		t.Fatalf("corrupted entry kept, %v entries", stat.Entries)
+	}
+}
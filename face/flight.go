@@ -0,0 +1,128 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+/*
+ * flight face
+ * - deduplicate identical in-flight calls
+ * - callers with same key share one call and one result
+ * - the shared call is canceled only when all callers gave up
+ * - the shared call keeps values of first caller, like trace parent
+ */
+
+//flight func
+type FlightFunc func(ctx context.Context) (interface{}, error)
+
+//one in-flight call
+type flightCall struct {
+	done chan struct{}
+	val interface{}
+	err error
+	waiters int
+	cancel context.CancelFunc
+}
+
+//face info
+type Flight struct {
+	calls map[string]*flightCall
+	sync.Mutex
+}
+
+//construct
+func NewFlight() *Flight {
+	this := &Flight{
+		calls: map[string]*flightCall{},
+	}
+	return this
+}
+
+//do call by key
+//shared is true when result came from other caller's call
+func (f *Flight) Do(
+		ctx context.Context,
+		key string,
+		fn FlightFunc,
+	) (val interface{}, err error, shared bool) {
+	//check
+	if key == "" || fn == nil {
+		return nil, errors.New("invalid parameter"), false
+	}
+
+	f.Lock()
+	call, ok := f.calls[key]
+	if ok {
+		//join in-flight call
+		call.waiters++
+		f.Unlock()
+		val, err = f.wait(ctx, key, call)
+		return val, err, true
+	}
+
+	//init new call, detached from cancel of first caller
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	call = &flightCall{
+		done: make(chan struct{}),
+		waiters: 1,
+		cancel: cancel,
+	}
+	f.calls[key] = call
+	f.Unlock()
+
+	//run call in son process
+	go f.run(callCtx, key, call, fn)
+	val, err = f.wait(ctx, key, call)
+	return val, err, false
+}
+
+////////////////
+//private func
+////////////////
+
+//run one call
+func (f *Flight) run(
+		ctx context.Context,
+		key string,
+		call *flightCall,
+		fn FlightFunc,
+	) {
+	call.val, call.err = fn(ctx)
+	call.cancel()
+
+	//remove from map
+	f.Lock()
+	if f.calls[key] == call {
+		delete(f.calls, key)
+	}
+	f.Unlock()
+	close(call.done)
+}
+
+//wait call result or caller cancel
+func (f *Flight) wait(
+		ctx context.Context,
+		key string,
+		call *flightCall,
+	) (interface{}, error) {
+	select {
+	case <- call.done:
+		return call.val, call.err
+	case <- ctx.Done():
+		//caller gave up
+		f.Lock()
+		call.waiters--
+		if call.waiters <= 0 {
+			//nobody waiting, cancel shared call
+			//later callers should start a new one
+			call.cancel()
+			if f.calls[key] == call {
+				delete(f.calls, key)
+			}
+		}
+		f.Unlock()
+		return nil, ctx.Err()
+	}
+}
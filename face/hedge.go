@@ -0,0 +1,87 @@
+package face
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+ * hedged read face
+ * - delay is fixed, or observed single file read p95 of the picked node
+ * - hedge budget is a token bucket, every read earns part of one token
+ */
+const (
+	DefaultHedgeMinDelay = time.Millisecond * 10
+	DefaultHedgeBudgetRatio = 0.1 //at most 10% extra reads
+	DefaultHedgeMaxBurst = 10
+	HedgeQuantile = 0.95
+)
+
+//hedge para
+type HedgePara struct {
+	Delay time.Duration //fixed delay, zero means node read p95
+	MinDelay time.Duration //min delay of p95 mode
+	BudgetRatio float64 //hedge tokens earned per read
+	MaxBurst float64 //max hedge tokens saved
+}
+
+//face info
+type Hedger struct {
+	para *HedgePara
+	tokens float64
+	sync.Mutex
+}
+
+//construct
+func NewHedger(para *HedgePara) *Hedger {
+	if para == nil {
+		para = &HedgePara{}
+	}
+	if para.MinDelay <= 0 {
+		para.MinDelay = DefaultHedgeMinDelay
+	}
+	if para.BudgetRatio <= 0 {
+		para.BudgetRatio = DefaultHedgeBudgetRatio
+	}
+	if para.MaxBurst < 1 {
+		para.MaxBurst = DefaultHedgeMaxBurst
+	}
+	this := &Hedger{
+		para: para,
+		tokens: para.MaxBurst,
+	}
+	return this
+}
+
+//get hedge delay of node
+func (f *Hedger) GetDelay(node *OneNode) time.Duration {
+	if f.para.Delay > 0 {
+		return f.para.Delay
+	}
+	delay := node.GetReadLatency(HedgeQuantile)
+	if delay < f.para.MinDelay {
+		delay = f.para.MinDelay
+	}
+	return delay
+}
+
+//earn hedge tokens by one read
+func (f *Hedger) OnRead() {
+	f.Lock()
+	defer f.Unlock()
+	f.tokens += f.para.BudgetRatio
+	if f.tokens > f.para.MaxBurst {
+		f.tokens = f.para.MaxBurst
+	}
+}
+
+//take one hedge token, false if out of budget
+func (f *Hedger) Allow() bool {
+	f.Lock()
+	defer f.Unlock()
+	if f.tokens < 1 {
+		return false
+	}
+	f.tokens--
+	return true
+}
@@ -0,0 +1,223 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * client side rate limiter face
+ * - token bucket rate and max in-flight per request class
+ * - one budget for whole client, one budget for each node
+ * - block until context done, or fail fast with ErrRateLimited
+ */
+
+//request class
+const (
+	LimitClassOfRead = "read"
+	LimitClassOfWrite = "write"
+	LimitClassOfList = "list"
+)
+
+//rate limited error
+var ErrRateLimited = errors.New("rate limited")
+
+//one class limit para
+type ClassLimitPara struct {
+	Rate float64 //requests per second, zero means no rate limit
+	Burst int //max saved tokens, zero means one second of rate
+	MaxInFlight int //zero means no in-flight limit
+}
+
+//rate limit para
+type RateLimitPara struct {
+	Client map[string]*ClassLimitPara //class -> para, for whole client
+	Node map[string]*ClassLimitPara //class -> para, for each node
+	FailFast bool //fail with ErrRateLimited instead of blocking
+}
+
+//one limiter of token bucket and in-flight slots
+type limiter struct {
+	rate float64
+	burst float64
+	tokens float64
+	lastAt time.Time
+	slots chan struct{} //nil means no in-flight limit
+	sync.Mutex
+}
+
+//face info
+type RateLimiter struct {
+	para *RateLimitPara
+	clientLimiters map[string]*limiter //class -> limiter
+	nodeLimiters sync.Map //tag|class -> *limiter
+}
+
+//construct
+func NewRateLimiter(para *RateLimitPara) *RateLimiter {
+	if para == nil {
+		para = &RateLimitPara{}
+	}
+	this := &RateLimiter{
+		para: para,
+		clientLimiters: map[string]*limiter{},
+	}
+	for class, classPara := range para.Client {
+		if classPara != nil {
+			this.clientLimiters[class] = newLimiter(classPara)
+		}
+	}
+	return this
+}
+
+//acquire client budget of class
+//release should be called when request done
+func (f *RateLimiter) AcquireClient(ctx context.Context, class string) (func(), error) {
+	return f.clientLimiters[class].acquire(ctx, f.para.FailFast)
+}
+
+//acquire node budget of class
+//release should be called when request done
+func (f *RateLimiter) AcquireNode(ctx context.Context, tag, class string) (func(), error) {
+	classPara := f.para.Node[class]
+	if classPara == nil {
+		return func() {}, nil
+	}
+	key := tag + "|" + class
+	v, ok := f.nodeLimiters.Load(key)
+	if !ok {
+		v, _ = f.nodeLimiters.LoadOrStore(key, newLimiter(classPara))
+	}
+	l, _ := v.(*limiter)
+	return l.acquire(ctx, f.para.FailFast)
+}
+
+//drop node budgets of tags not in live tags
+//called after node removed
+func (f *RateLimiter) RetainNodes(tags []string) {
+	live := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		live[tag] = true
+	}
+	sf := func(k, v interface{}) bool {
+		key, _ := k.(string)
+		tag := key[:strings.LastIndex(key, "|")]
+		if !live[tag] {
+			f.nodeLimiters.Delete(k)
+		}
+		return true
+	}
+	f.nodeLimiters.Range(sf)
+}
+
+////////////////
+//private func
+////////////////
+
+//new limiter
+func newLimiter(para *ClassLimitPara) *limiter {
+	this := &limiter{
+		rate: para.Rate,
+		burst: float64(para.Burst),
+		lastAt: time.Now(),
+	}
+	if this.burst <= 0 {
+		this.burst = this.rate
+	}
+	if this.burst < 1 {
+		this.burst = 1
+	}
+	this.tokens = this.burst
+	if para.MaxInFlight > 0 {
+		this.slots = make(chan struct{}, para.MaxInFlight)
+	}
+	return this
+}
+
+//acquire in-flight slot and rate token
+func (l *limiter) acquire(ctx context.Context, failFast bool) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	//take in-flight slot first
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if failFast {
+				return nil, ErrRateLimited
+			}
+			select {
+			case l.slots <- struct{}{}:
+			case <- ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<- l.slots
+		}
+	}
+	if l.rate <= 0 {
+		return release, nil
+	}
+
+	//take rate token
+	wait, ok := l.reserve(failFast)
+	if !ok {
+		release()
+		return nil, ErrRateLimited
+	}
+	if wait <= 0 {
+		return release, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <- timer.C:
+		return release, nil
+	case <- ctx.Done():
+		l.cancelReserve()
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+//reserve one token, return wait duration
+//false if no token and fail fast
+func (l *limiter) reserve(failFast bool) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.lastAt).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastAt = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	if failFast {
+		return 0, false
+	}
+	//token owed, wait until refilled
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	return wait, true
+}
+
+//give back reserved token
+func (l *limiter) cancelReserve() {
+	l.Lock()
+	defer l.Unlock()
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
@@ -0,0 +1,125 @@
+package face
+
+import (
+	"math/rand"
+)
+
+/*
+ * locality aware node picking
+ * - node labels of zone, region and weight
+ * - same zone nodes preferred, then same region, then any
+ * - spill over when local nodes are unhealthy or overloaded
+ */
+const (
+	DefaultNodeWeight = 1
+)
+
+//node labels
+type NodeLabels struct {
+	Zone string
+	Region string
+	Weight int //relative pick weight, zero means default
+}
+
+//client locality para
+type LocalityPara struct {
+	Zone string //client zone
+	Region string //client region
+	MaxInFlight int64 //node overloaded threshold, zero means no limit
+}
+
+//set client locality, nil means disable
+func (f *Node) SetLocality(para *LocalityPara) {
+	f.Lock()
+	defer f.Unlock()
+	f.locality = para
+}
+
+//get client locality, nil if disabled
+func (f *Node) GetLocality() *LocalityPara {
+	f.RLock()
+	defer f.RUnlock()
+	return f.locality
+}
+
+//get node pick weight
+func (n *OneNode) GetWeight() int {
+	if n.Labels.Weight <= 0 {
+		return DefaultNodeWeight
+	}
+	return n.Labels.Weight
+}
+
+////////////////
+//private func
+////////////////
+
+//pick nodes by locality
+//return all nodes if no locality or no available local node
+func (f *Node) pickByLocality(nodes []*OneNode, para *LocalityPara) []*OneNode {
+	if para == nil {
+		return nodes
+	}
+
+	//skip unhealthy and overloaded nodes
+	available := make([]*OneNode, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.IsHealthy() {
+			continue
+		}
+		if para.MaxInFlight > 0 && node.GetInFlight() >= para.MaxInFlight {
+			continue
+		}
+		available = append(available, node)
+	}
+
+	//same zone first, then same region
+	sf := func(match func(node *OneNode) bool) []*OneNode {
+		var matched []*OneNode
+		for _, node := range available {
+			if match(node) {
+				matched = append(matched, node)
+			}
+		}
+		return matched
+	}
+	if para.Zone != "" {
+		matched := sf(func(node *OneNode) bool {
+			return node.Labels.Zone == para.Zone
+		})
+		if len(matched) > 0 {
+			return matched
+		}
+	}
+	if para.Region != "" {
+		matched := sf(func(node *OneNode) bool {
+			return node.Labels.Region == para.Region
+		})
+		if len(matched) > 0 {
+			return matched
+		}
+	}
+	if len(available) > 0 {
+		return available
+	}
+	return nodes
+}
+
+//pick one node by weight
+func pickWeighted(nodes []*OneNode) *OneNode {
+	total := 0
+	for _, node := range nodes {
+		total += node.GetWeight()
+	}
+	if total <= 0 {
+		return nil
+	}
+	randVal := rand.Intn(total)
+	for _, node := range nodes {
+		randVal -= node.GetWeight()
+		if randVal < 0 {
+			return node
+		}
+	}
+	return nodes[len(nodes) - 1]
+}
@@ -1,10 +1,10 @@
 package face
 
 import (
+	"context"
 	"errors"
 	"github.com/andyzhou/tinyrpc"
-	"log"
-	"math/rand"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,14 +17,40 @@ const (
 	DefaultMaxMsgSize = 1024 * 1024 * 10 //10MB
 	DefaultNodeConnDelaySeconds = 5 //xx seconds
 	DefaultNodeCheckRate = 5 //xx seconds
+	DefaultDrainCheckRate = time.Millisecond * 10
 )
 
+//node pick policy
+const (
+	PickPolicyOfRandom = "random"
+	PickPolicyOfZone = "zone"
+)
+
+//node event
+const (
+	NodeEventOfAdd = iota
+	NodeEventOfDel
+	NodeEventOfDown
+	NodeEventOfConnect
+	NodeEventOfReconnect
+)
+
+//no any node error
+var ErrNoNode = errors.New("no any node")
+
 //one node info
 type OneNode struct {
 	Tag string
 	Address string
 	Client *tinyrpc.Client
-	Connected bool
+	Connected atomic.Bool
+	Labels NodeLabels //zone, region and weight
+	reconnecting atomic.Bool //reconnect by son process
+	draining int32 //atomic value, 1 means skipped by picking
+	holds int32 //atomic value, calls picked this node and not done
+	proto nodeProto //negotiated by handshake
+	handshaking atomic.Bool //handshake request not returned yet
+	stat nodeStat //request stat
 }
 
 //face info
@@ -34,6 +60,9 @@ type Node struct {
 	nodes int32
 	ticker *time.Ticker
 	closeChan chan bool
+	cbOfEvent func(event int, addr string) //cb for node event
+	logger *slog.Logger //slog default logger if nil
+	locality *LocalityPara //optional, for locality aware picking
 	sync.RWMutex
 }
 
@@ -55,6 +84,34 @@ func (f *Node) Quit() {
 	}
 }
 
+//set callback for node event
+func (f *Node) SetEventCallBack(cb func(event int, addr string)) {
+	f.Lock()
+	defer f.Unlock()
+	f.cbOfEvent = cb
+}
+
+//set logger, nil means slog default logger
+func (f *Node) SetLogger(logger *slog.Logger) {
+	f.Lock()
+	defer f.Unlock()
+	f.logger = logger
+}
+
+//get connected node count
+func (f *Node) GetHealthyCount() int {
+	count := 0
+	sf := func(k, v interface{}) bool {
+		node, ok := v.(*OneNode)
+		if ok && node != nil && node.Connected.Load() {
+			count++
+		}
+		return true
+	}
+	f.nodeMap.Range(sf)
+	return count
+}
+
 //get tags
 func (f *Node) GetTags() []string {
 	return f.tags
@@ -81,8 +138,7 @@ func (f *Node) DelNode(tag string) error {
 
 	//remove from map
 	f.nodeMap.Delete(tag)
-	atomic.AddInt32(&f.nodes, -1)
-	if f.nodes < 0 {
+	if atomic.AddInt32(&f.nodes, -1) < 0 {
 		atomic.StoreInt32(&f.nodes, 0)
 	}
 
@@ -97,9 +153,10 @@ func (f *Node) DelNode(tag string) error {
 	if hitIdx >= 0 {
 		//remove element
 		f.Lock()
-		defer f.Unlock()
 		f.tags = append(f.tags[:hitIdx], f.tags[hitIdx+1:]...)
+		f.Unlock()
 	}
+	f.notifyEvent(NodeEventOfDel, node.Address)
 	return nil
 }
 
@@ -160,20 +217,167 @@ func (f *Node) GetNodeByAddr(addr string) (*OneNode, error) {
 	return target, nil
 }
 
-//pick rand node
-func (f *Node) PickNode() (*OneNode, error) {
-	if f.nodes <= 0 {
-		return nil, errors.New("no any node")
+//drain node, new requests skip it
+//in-flight requests are not affected
+func (f *Node) Drain(tag string) error {
+	node, err := f.GetNode(tag)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return errors.New("no such node")
 	}
-	rand.Seed(time.Now().UnixNano())
-	randIdx := rand.Intn(int(f.nodes))
-	tag := f.tags[randIdx]
+	atomic.StoreInt32(&node.draining, 1)
+	f.getLogger().Info("drain node", "node", node.Address)
+	return nil
+}
+
+//undrain node, re-enable picking
+func (f *Node) Undrain(tag string) error {
 	node, err := f.GetNode(tag)
-	return node, err
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return errors.New("no such node")
+	}
+	atomic.StoreInt32(&node.draining, 0)
+	f.getLogger().Info("undrain node", "node", node.Address)
+	return nil
+}
+
+//drain node, wait in-flight requests done and remove it
+//node kept draining if context done before
+func (f *Node) DrainAndRemove(ctx context.Context, addr string) error {
+	node, err := f.GetNodeByAddr(addr)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return errors.New("address not exists")
+	}
+	err = f.Drain(node.Tag)
+	if err != nil {
+		return err
+	}
+
+	//wait held calls done
+	//call holds node before checking draining, no new call after zero
+	ticker := time.NewTicker(DefaultDrainCheckRate)
+	defer ticker.Stop()
+	for node.GetHolds() > 0 || node.GetInFlight() > 0 {
+		select {
+		case <- ticker.C:
+		case <- ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return f.DelNode(node.Tag)
+}
+
+//force reconnect node
+//skipped if node is reconnecting
+func (f *Node) Reconnect(tag string) error {
+	node, err := f.GetNode(tag)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return errors.New("no such node")
+	}
+	if node.reconnecting.Load() {
+		return nil
+	}
+	return f.cbForServerNodeDown(node.Address)
+}
+
+//get node pick policy
+func (f *Node) GetPickPolicy() string {
+	if f.GetLocality() != nil {
+		return PickPolicyOfZone
+	}
+	return PickPolicyOfRandom
+}
+
+//check node draining
+func (n *OneNode) IsDraining() bool {
+	return atomic.LoadInt32(&n.draining) == 1
+}
+
+//hold node for one call, failed if node draining
+//Unhold should be called when call done
+func (n *OneNode) Hold() bool {
+	//count first, drain sees it or we see draining
+	atomic.AddInt32(&n.holds, 1)
+	if n.IsDraining() {
+		n.Unhold()
+		return false
+	}
+	return true
+}
+
+//hold node already held by caller once more, even if draining
+//for work outliving the call, like request left on wire
+func (n *OneNode) Retain() {
+	atomic.AddInt32(&n.holds, 1)
+}
+
+//release node held by call
+func (n *OneNode) Unhold() {
+	atomic.AddInt32(&n.holds, -1)
+}
+
+//get count of calls holding node
+func (n *OneNode) GetHolds() int32 {
+	return atomic.LoadInt32(&n.holds)
+}
+
+//pick rand node by weight, prefer local nodes if locality setup
+//nodes with exclude tags and draining nodes will be skipped
+func (f *Node) PickNode(excludeTags ...string) (*OneNode, error) {
+	nodes, locality := f.getPickable(excludeTags)
+	node := pickWeighted(f.pickByLocality(nodes, locality))
+	if node == nil {
+		return nil, ErrNoNode
+	}
+	return node, nil
+}
+
+//pick node as PickNode and hold it for one call
+//Unhold should be called when call done
+func (f *Node) PickAndHold(excludeTags ...string) (*OneNode, error) {
+	nodes, locality := f.getPickable(excludeTags)
+	for len(nodes) > 0 {
+		node := pickWeighted(f.pickByLocality(nodes, locality))
+		if node == nil {
+			break
+		}
+		if node.Hold() {
+			return node, nil
+		}
+		//drained after collected, pick again without it
+		left := make([]*OneNode, 0, len(nodes))
+		for _, v := range nodes {
+			if v != node {
+				left = append(left, v)
+			}
+		}
+		nodes = left
+	}
+	return nil, ErrNoNode
 }
 
 //add node
 func (f *Node) AddNode(tag, address string, maxMsgSizes ...int) error {
+	return f.AddNodeWithLabels(tag, address, nil, maxMsgSizes...)
+}
+
+//add node with labels
+func (f *Node) AddNodeWithLabels(
+		tag, address string,
+		labels *NodeLabels,
+		maxMsgSizes ...int,
+	) error {
 	var (
 		maxMsgSize int
 	)
@@ -191,6 +395,9 @@ func (f *Node) AddNode(tag, address string, maxMsgSizes ...int) error {
 		Tag: tag,
 		Address: address,
 	}
+	if labels != nil {
+		newNode.Labels = *labels
+	}
 
 	//save node info
 	defer func() {
@@ -200,8 +407,9 @@ func (f *Node) AddNode(tag, address string, maxMsgSizes ...int) error {
 
 		//update tag slice
 		f.Lock()
-		defer f.Unlock()
 		f.tags = append(f.tags, tag)
+		f.Unlock()
+		f.notifyEvent(NodeEventOfAdd, address)
 	}()
 
 	//detect
@@ -232,7 +440,10 @@ func (f *Node) AddNode(tag, address string, maxMsgSizes ...int) error {
 	}
 
 	//set new node
-	newNode.Connected = true
+	newNode.Connected.Store(true)
+
+	//negotiate protocol in background
+	f.startHandshake(newNode)
 	return nil
 }
 
@@ -251,6 +462,10 @@ func (f *Node) cbForServerNodeDown(serverAddr string) error {
 	sf := func() {
 		rpcNode, _ := f.getNodeByAddr(serverAddr)
 		if rpcNode != nil {
+			rpcNode.Connected.Store(false)
+			rpcNode.reconnecting.Store(true)
+			f.notifyEvent(NodeEventOfDown, serverAddr)
+
 			//force close rpc client
 			if rpcNode.Client != nil {
 				rpcNode.Client.Quit()
@@ -287,12 +502,15 @@ func (f *Node) reConnectDownedServerNode(serverNode *OneNode) error {
 		//connect server
 		err = newClient.ConnectServer()
 		if err != nil {
-			log.Printf("connect rpc server %v failed, err:%v\n", nodeAddr, err.Error())
+			f.getLogger().Warn("reconnect node failed",
+				"node", nodeAddr,
+				"err", err)
 			newClient.Quit()
 			time.Sleep(time.Second * DefaultNodeConnDelaySeconds)
 		}else{
 			//connect success
-			log.Printf("connect rpc server %v success..\n", nodeAddr)
+			f.getLogger().Info("reconnect node succeed",
+				"node", nodeAddr)
 			finalClient = newClient
 			break
 		}
@@ -300,7 +518,12 @@ func (f *Node) reConnectDownedServerNode(serverNode *OneNode) error {
 
 	//update active client
 	serverNode.Client = finalClient
+	f.startHandshake(serverNode)
+	serverNode.Connected.Store(true)
+	serverNode.reconnecting.Store(false)
+	serverNode.markReconnect()
 	f.nodeMap.Store(serverNode.Tag, serverNode)
+	f.notifyEvent(NodeEventOfReconnect, nodeAddr)
 	return nil
 }
 
@@ -330,20 +553,56 @@ func (f *Node) getNodeByAddr(addr string) (*OneNode, error) {
 	return target, nil
 }
 
+//get pickable nodes and locality
+//nodes with exclude tags and draining nodes skipped
+func (f *Node) getPickable(excludeTags []string) ([]*OneNode, *LocalityPara) {
+	if atomic.LoadInt32(&f.nodes) <= 0 {
+		return nil, nil
+	}
+	f.RLock()
+	defer f.RUnlock()
+	nodes := make([]*OneNode, 0, len(f.tags))
+	for _, tag := range f.tags {
+		node, _ := f.GetNode(tag)
+		if node == nil || node.IsDraining() {
+			continue
+		}
+		excluded := false
+		for _, excludeTag := range excludeTags {
+			if tag == excludeTag {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, f.locality
+}
+
 //check inter node
 func (f *Node) checkNodes() {
 	//check
-	if f.nodes <= 0 {
+	if atomic.LoadInt32(&f.nodes) <= 0 {
 		return
 	}
 	//loop check
 	//if client not connected, just re-connect
+	//if protocol not negotiated, handshake again
 	sf := func(k, v interface{}) bool {
 		nodeObj, ok := v.(*OneNode)
-		if ok && nodeObj != nil && !nodeObj.Connected {
+		if ok && nodeObj != nil && nodeObj.Connected.Load() && !nodeObj.reconnecting.Load() && !nodeObj.IsNegotiated() {
+			f.startHandshake(nodeObj)
+			return true
+		}
+		if ok && nodeObj != nil && !nodeObj.Connected.Load() && !nodeObj.reconnecting.Load() {
 			err := nodeObj.Client.ConnectServer()
 			if err == nil {
-				nodeObj.Connected = true
+				nodeObj.Connected.Store(true)
+				nodeObj.markReconnect()
+				f.startHandshake(nodeObj)
+				f.notifyEvent(NodeEventOfConnect, nodeObj.Address)
 			}
 		}
 		return true
@@ -351,6 +610,26 @@ func (f *Node) checkNodes() {
 	f.nodeMap.Range(sf)
 }
 
+//get logger
+func (f *Node) getLogger() *slog.Logger {
+	f.RLock()
+	defer f.RUnlock()
+	if f.logger == nil {
+		return slog.Default()
+	}
+	return f.logger
+}
+
+//notify node event
+func (f *Node) notifyEvent(event int, addr string) {
+	f.RLock()
+	cb := f.cbOfEvent
+	f.RUnlock()
+	if cb != nil {
+		cb(event, addr)
+	}
+}
+
 //inter ticker checker
 func (f *Node) nodeCheckTicker() {
 	var (
@@ -0,0 +1,157 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+ * drain and remove test
+ * - held node is not removed until released
+ * - PickNode never holds node
+ * - no call holds node after it removed
+ */
+
+//add node without rpc client
+func addTestNode(f *Node, tag, address string) *OneNode {
+	node := &OneNode{
+		Tag: tag,
+		Address: address,
+	}
+	node.Connected.Store(true)
+	f.nodeMap.Store(tag, node)
+	atomic.AddInt32(&f.nodes, 1)
+	f.Lock()
+	f.tags = append(f.tags, tag)
+	f.Unlock()
+	return node
+}
+
+func TestDrainWaitHeld(t *testing.T) {
+	f := NewNode()
+	defer f.Quit()
+	addTestNode(f, "1", "node-1")
+
+	//pick and hold
+	node, err := f.PickAndHold()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 50)
+	defer cancel()
+	err = f.DrainAndRemove(ctx, node.Address)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline while held, got %v", err)
+	}
+	if v, _ := f.GetNode(node.Tag); v == nil {
+		t.Fatal("held node removed")
+	}
+
+	//draining node can't be picked or held
+	if _, err = f.PickAndHold(); !errors.Is(err, ErrNoNode) {
+		t.Fatalf("expect no node, got %v", err)
+	}
+	if _, err = f.PickNode(); !errors.Is(err, ErrNoNode) {
+		t.Fatalf("expect no node, got %v", err)
+	}
+	if node.Hold() {
+		t.Fatal("draining node held")
+	}
+
+	//retained by request left on wire
+	node.Retain()
+	node.Unhold()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond * 50)
+	defer cancel()
+	err = f.DrainAndRemove(ctx, node.Address)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline while retained, got %v", err)
+	}
+
+	//released, removed
+	node.Unhold()
+	err = f.DrainAndRemove(context.Background(), node.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := f.GetNode(node.Tag); v != nil {
+		t.Fatal("node not removed")
+	}
+}
+
+func TestPickNodeNotHeld(t *testing.T) {
+	f := NewNode()
+	defer f.Quit()
+	addTestNode(f, "1", "node-1")
+	node, err := f.PickNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.GetHolds() != 0 {
+		t.Fatalf("picked node held %v", node.GetHolds())
+	}
+	err = f.DrainAndRemove(context.Background(), node.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainRacePick(t *testing.T) {
+	var (
+		wg sync.WaitGroup
+		removed, lateHolds int32
+	)
+	f := NewNode()
+	defer f.Quit()
+	addTestNode(f, "1", "node-1")
+	addTestNode(f, "2", "node-2")
+	f.SetEventCallBack(func(event int, addr string) {
+		if event == NodeEventOfDel && addr == "node-1" {
+			atomic.StoreInt32(&removed, 1)
+		}
+	})
+
+	//pickers hold node for a short call
+	stopChan := make(chan struct{})
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <- stopChan:
+					return
+				default:
+				}
+				node, err := f.PickAndHold()
+				if err != nil {
+					continue
+				}
+				if node.Address == "node-1" && atomic.LoadInt32(&removed) == 1 {
+					atomic.AddInt32(&lateHolds, 1)
+				}
+				time.Sleep(time.Microsecond * 100)
+				if node.Address == "node-1" && atomic.LoadInt32(&removed) == 1 {
+					atomic.AddInt32(&lateHolds, 1)
+				}
+				node.Unhold()
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	err := f.DrainAndRemove(context.Background(), "node-1")
+	time.Sleep(time.Millisecond * 20)
+	close(stopChan)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lateHolds > 0 {
+		t.Fatalf("%v calls held node after removed", lateHolds)
+	}
+}
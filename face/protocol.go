@@ -0,0 +1,216 @@
+package face
+
+import (
+	"errors"
+	"github.com/andyzhou/tinyfs_client/codec"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/json"
+	"github.com/andyzhou/tinyrpc/proto"
+	"sync"
+	"time"
+)
+
+/*
+ * protocol handshake face
+ * - exchange protocol version and capability set on connect
+ * - server without handshake support treated as version 0 with base capabilities
+ * - transient handshake failure retried by node checker
+ * - handshake run in background, one request per node at a time,
+ *   new one skipped until timed out request returned
+ */
+const (
+	DefaultHandshakeTimeout = 5 //xx seconds
+)
+
+//negotiated protocol of one node
+type nodeProto struct {
+	version int
+	caps map[string]bool
+	codecs map[string]bool
+	sync.RWMutex
+}
+
+//get negotiated protocol version
+func (n *OneNode) GetVersion() int {
+	n.proto.RLock()
+	defer n.proto.RUnlock()
+	return n.proto.version
+}
+
+//check capability advertised by server
+func (n *OneNode) HasCap(capability string) bool {
+	n.proto.RLock()
+	defer n.proto.RUnlock()
+	if n.proto.caps == nil {
+		//not negotiated yet
+		for _, v := range define.BaseCapabilities {
+			if v == capability {
+				return true
+			}
+		}
+		return false
+	}
+	return n.proto.caps[capability]
+}
+
+//check codec advertised by server
+func (n *OneNode) HasCodec(name string) bool {
+	if name == define.CodecOfJson {
+		return true
+	}
+	n.proto.RLock()
+	defer n.proto.RUnlock()
+	return n.proto.codecs[name]
+}
+
+//check protocol negotiated
+//not negotiated node uses base capabilities
+func (n *OneNode) IsNegotiated() bool {
+	n.proto.RLock()
+	defer n.proto.RUnlock()
+	return n.proto.caps != nil
+}
+
+//get capabilities advertised by server
+func (n *OneNode) GetCaps() []string {
+	n.proto.RLock()
+	defer n.proto.RUnlock()
+	if n.proto.caps == nil {
+		return append([]string{}, define.BaseCapabilities...)
+	}
+	caps := make([]string, 0, len(n.proto.caps))
+	for capability := range n.proto.caps {
+		caps = append(caps, capability)
+	}
+	return caps
+}
+
+//set negotiated protocol
+func (n *OneNode) setProto(version int, caps, codecs []string) {
+	n.proto.Lock()
+	defer n.proto.Unlock()
+	n.proto.version = version
+	n.proto.caps = map[string]bool{}
+	n.proto.codecs = map[string]bool{}
+	for _, v := range caps {
+		n.proto.caps[v] = true
+	}
+	for _, v := range codecs {
+		n.proto.codecs[v] = true
+	}
+}
+
+//reset protocol, negotiated again by next handshake
+func (n *OneNode) resetProto() {
+	n.proto.Lock()
+	defer n.proto.Unlock()
+	n.proto.version = 0
+	n.proto.caps = nil
+	n.proto.codecs = nil
+}
+
+////////////////
+//private func
+////////////////
+
+//get error code of handshake resp, for log field
+func handshakeCode(resp *proto.Packet) int32 {
+	if resp == nil {
+		return -1
+	}
+	return resp.ErrCode
+}
+
+//start handshake in background
+//skipped if request of last handshake not returned
+func (f *Node) startHandshake(node *OneNode) {
+	if node == nil || !node.handshaking.CompareAndSwap(false, true) {
+		return
+	}
+	go f.handshake(node)
+}
+
+//handshake with node server
+func (f *Node) handshake(node *OneNode) error {
+	//check
+	if node == nil || node.Client == nil {
+		if node != nil {
+			node.handshaking.Store(false)
+		}
+		return nil
+	}
+
+	//init handshake request, always in json
+	reqObj := json.NewHandshakeReqJson()
+	reqObj.Version = define.ProtocolVersion
+	reqObj.Capabilities = define.ClientCapabilities
+	reqObj.Codecs = codec.Names()
+	reqBytes, err := reqObj.Encode(reqObj)
+	if err != nil {
+		node.handshaking.Store(false)
+		return err
+	}
+
+	//gen packet
+	pack := node.Client.GenPacket()
+	pack.MessageId = define.MessageIdOfHandshake
+	pack.Data = reqBytes
+
+	//send request to target node
+	resp, err := f.sendHandshake(node, pack)
+	if err != nil {
+		//transient failure, negotiate again by node checker
+		f.getLogger().Warn("handshake failed, retry later",
+			"node", node.Address,
+			"err", err)
+		node.resetProto()
+		return err
+	}
+	if resp.ErrCode != define.ErrCodeOfSucceed {
+		//old server without handshake
+		f.getLogger().Info("handshake not supported, use base capabilities",
+			"node", node.Address,
+			"code", handshakeCode(resp))
+		node.setProto(0, define.BaseCapabilities, nil)
+		return nil
+	}
+
+	//decode origin resp
+	respObj := json.NewHandshakeRespJson()
+	err = respObj.Decode(resp.Data, respObj)
+	if err != nil {
+		node.setProto(0, define.BaseCapabilities, nil)
+		return err
+	}
+	node.setProto(respObj.Version, respObj.Capabilities, respObj.Codecs)
+	return nil
+}
+
+//send handshake request, wait at most handshake timeout
+//handshaking flag cleared when request returned, even after timeout
+func (f *Node) sendHandshake(node *OneNode, pack *proto.Packet) (*proto.Packet, error) {
+	type sendResult struct {
+		resp *proto.Packet
+		err error
+	}
+	resultChan := make(chan sendResult, 1)
+	client := node.Client
+	go func() {
+		defer node.handshaking.Store(false)
+		resp, err := client.SendRequest(pack)
+		if err == nil && resp == nil {
+			err = errors.New("empty response packet")
+		}
+		resultChan <- sendResult{resp: resp, err: err}
+	}()
+
+	//wait result or timeout
+	timer := time.NewTimer(time.Duration(DefaultHandshakeTimeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case result := <- resultChan:
+		return result.resp, result.err
+	case <- timer.C:
+		return nil, errors.New("handshake timeout")
+	}
+}
@@ -0,0 +1,206 @@
+package face
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * node stat face
+ * - in-flight, total requests and errors by code per node
+ * - latency percentiles over a window of recent samples
+ * - single file read latency kept apart, for hedge delay
+ * - last error and last reconnect time
+ */
+const (
+	DefaultLatencyWindow = 1024 //latency samples kept per node
+	DefaultLatencyResortRate = 32 //resort after window / rate new samples
+)
+
+//one node stat snapshot
+type NodeStat struct {
+	Tag string `json:"tag"`
+	Address string `json:"address"`
+	Zone string `json:"zone"`
+	Region string `json:"region"`
+	Weight int `json:"weight"`
+	Connected bool `json:"connected"`
+	Healthy bool `json:"healthy"` //connected and not reconnecting
+	Draining bool `json:"draining"`
+	InFlight int64 `json:"inFlight"`
+	Requests int64 `json:"requests"`
+	Errors map[string]int64 `json:"errors"` //code -> count
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	LastError string `json:"lastError"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+	LastReconnectAt time.Time `json:"lastReconnectAt"`
+}
+
+//ring of recent latency samples, run in locker
+type latencyRing struct {
+	samples []time.Duration
+	idx int
+	sorted []time.Duration //sorted copy of samples, read only
+	unsorted int //new samples since last sort
+}
+
+//stat recorder of one node
+type nodeStat struct {
+	inFlight int64 //atomic value
+	requests int64 //atomic value
+	errors map[string]int64
+	latency latencyRing //all requests
+	readLatency latencyRing //succeed single file reads
+	lastErr string
+	lastErrAt time.Time
+	lastReconnectAt time.Time
+	sync.Mutex
+}
+
+//begin one request on node
+func (n *OneNode) BeginRequest() {
+	atomic.AddInt64(&n.stat.inFlight, 1)
+	atomic.AddInt64(&n.stat.requests, 1)
+}
+
+//end one request on node
+//code is empty if request succeed
+func (n *OneNode) EndRequest(cost time.Duration, code string, err error) {
+	atomic.AddInt64(&n.stat.inFlight, -1)
+	n.stat.Lock()
+	defer n.stat.Unlock()
+	n.stat.latency.add(cost)
+	if code == "" {
+		return
+	}
+	if n.stat.errors == nil {
+		n.stat.errors = map[string]int64{}
+	}
+	n.stat.errors[code]++
+	if err != nil {
+		n.stat.lastErr = err.Error()
+		n.stat.lastErrAt = time.Now()
+	}
+}
+
+//add latency of succeed single file read
+//payload sizes of other operations differ too much for read hedge
+func (n *OneNode) AddReadLatency(cost time.Duration) {
+	n.stat.Lock()
+	defer n.stat.Unlock()
+	n.stat.readLatency.add(cost)
+}
+
+//get in-flight request count
+func (n *OneNode) GetInFlight() int64 {
+	return atomic.LoadInt64(&n.stat.inFlight)
+}
+
+//get latency of quantile in (0, 1], zero if no sample
+func (n *OneNode) GetLatency(quantile float64) time.Duration {
+	return quantileOf(n.sortedLatency(&n.stat.latency), quantile)
+}
+
+//get single file read latency of quantile in (0, 1], zero if no sample
+func (n *OneNode) GetReadLatency(quantile float64) time.Duration {
+	return quantileOf(n.sortedLatency(&n.stat.readLatency), quantile)
+}
+
+//check node healthy
+func (n *OneNode) IsHealthy() bool {
+	return n.Connected.Load() && !n.reconnecting.Load()
+}
+
+//get stat snapshot
+func (n *OneNode) GetStat() NodeStat {
+	samples := n.sortedLatency(&n.stat.latency)
+	stat := NodeStat{
+		Tag: n.Tag,
+		Address: n.Address,
+		Zone: n.Labels.Zone,
+		Region: n.Labels.Region,
+		Weight: n.GetWeight(),
+		Connected: n.Connected.Load(),
+		Healthy: n.IsHealthy(),
+		Draining: n.IsDraining(),
+		InFlight: atomic.LoadInt64(&n.stat.inFlight),
+		Requests: atomic.LoadInt64(&n.stat.requests),
+		Errors: map[string]int64{},
+		P50: quantileOf(samples, 0.5),
+		P95: quantileOf(samples, 0.95),
+		P99: quantileOf(samples, 0.99),
+	}
+	n.stat.Lock()
+	defer n.stat.Unlock()
+	for k, v := range n.stat.errors {
+		stat.Errors[k] = v
+	}
+	stat.LastError = n.stat.lastErr
+	stat.LastErrorAt = n.stat.lastErrAt
+	stat.LastReconnectAt = n.stat.lastReconnectAt
+	return stat
+}
+
+////////////////
+//private func
+////////////////
+
+//mark node reconnected
+func (n *OneNode) markReconnect() {
+	n.stat.Lock()
+	defer n.stat.Unlock()
+	n.stat.lastReconnectAt = time.Now()
+}
+
+//get sorted latency samples of ring, result is read only
+func (n *OneNode) sortedLatency(ring *latencyRing) []time.Duration {
+	n.stat.Lock()
+	defer n.stat.Unlock()
+	return ring.getSorted()
+}
+
+//add one sample
+func (r *latencyRing) add(cost time.Duration) {
+	if len(r.samples) < DefaultLatencyWindow {
+		r.samples = append(r.samples, cost)
+	}else{
+		r.samples[r.idx] = cost
+		r.idx = (r.idx + 1) % DefaultLatencyWindow
+	}
+	r.unsorted++
+}
+
+//get sorted samples, result is read only
+//resort only after enough new samples, keep it cheap for every read
+func (r *latencyRing) getSorted() []time.Duration {
+	if r.unsorted <= 0 ||
+		(r.sorted != nil && r.unsorted < len(r.samples) / DefaultLatencyResortRate) {
+		return r.sorted
+	}
+	samples := append([]time.Duration{}, r.samples...)
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	r.sorted = samples
+	r.unsorted = 0
+	return samples
+}
+
+//get quantile of sorted samples
+func quantileOf(samples []time.Duration, quantile float64) time.Duration {
+	if len(samples) <= 0 {
+		return 0
+	}
+	idx := int(float64(len(samples)) * quantile + 0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(samples) {
+		idx = len(samples) - 1
+	}
+	return samples[idx]
+}
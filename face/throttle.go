@@ -0,0 +1,110 @@
+package face
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+ * byte throttle face
+ * - token bucket of bytes per second
+ * - large payload admitted in chunks, progress reported per chunk
+ */
+const (
+	DefaultThrottleChunk = 1024 * 64 //64KB
+)
+
+//throttle para
+type ThrottlePara struct {
+	BytesPerSec int64
+	Burst int64 //max saved bytes, zero means one second of rate
+}
+
+//face info
+type Throttle struct {
+	para *ThrottlePara
+	tokens float64
+	lastAt time.Time
+	sync.Mutex
+}
+
+//construct
+func NewThrottle(para *ThrottlePara) (*Throttle, error) {
+	//check
+	if para == nil || para.BytesPerSec <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	if para.Burst <= 0 {
+		para.Burst = para.BytesPerSec
+	}
+	this := &Throttle{
+		para: para,
+		tokens: float64(para.Burst),
+		lastAt: time.Now(),
+	}
+	return this, nil
+}
+
+//wait until size bytes admitted or context done
+//cb called with admitted bytes after every chunk, nil means no report
+func (f *Throttle) Wait(ctx context.Context, size int64, cb func(done int64)) error {
+	var (
+		done int64
+	)
+	for done < size {
+		chunk := size - done
+		if chunk > DefaultThrottleChunk {
+			chunk = DefaultThrottleChunk
+		}
+		wait := f.reserve(chunk)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <- timer.C:
+			case <- ctx.Done():
+				timer.Stop()
+				f.cancelReserve(chunk)
+				return ctx.Err()
+			}
+		}
+		done += chunk
+		if cb != nil {
+			cb(done)
+		}
+	}
+	return nil
+}
+
+////////////////
+//private func
+////////////////
+
+//reserve bytes, return wait duration
+func (f *Throttle) reserve(size int64) time.Duration {
+	f.Lock()
+	defer f.Unlock()
+	now := time.Now()
+	rate := float64(f.para.BytesPerSec)
+	f.tokens += now.Sub(f.lastAt).Seconds() * rate
+	if f.tokens > float64(f.para.Burst) {
+		f.tokens = float64(f.para.Burst)
+	}
+	f.lastAt = now
+	f.tokens -= float64(size)
+	if f.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-f.tokens / rate * float64(time.Second))
+}
+
+//give back reserved bytes
+func (f *Throttle) cancelReserve(size int64) {
+	f.Lock()
+	defer f.Unlock()
+	f.tokens += float64(size)
+	if f.tokens > float64(f.para.Burst) {
+		f.tokens = float64(f.para.Burst)
+	}
+}
@@ -0,0 +1,96 @@
+package face
+
+import (
+	"errors"
+	"github.com/andyzhou/tinyfs_client/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * upload session store face
+ * - one json file per local session key
+ * - written with temp file and rename, survive process restart
+ */
+const (
+	UploadSessionExt = ".session"
+)
+
+//face info
+type UploadStore struct {
+	dir string
+}
+
+//construct
+func NewUploadStore(dir string) (*UploadStore, error) {
+	//check
+	if dir == "" {
+		return nil, errors.New("invalid parameter")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	//remove temp files of broken writes
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), DiskCacheTempPrefix) {
+			os.Remove(filepath.Join(dir, file.Name()))
+		}
+	}
+	this := &UploadStore{
+		dir: dir,
+	}
+	return this, nil
+}
+
+//load session by key, nil if not exists
+func (f *UploadStore) Load(key string) (*json.UploadSession, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := json.NewUploadSession()
+	err = session.Decode(data, session)
+	if err != nil || session.Key != key {
+		//corrupted, just remove it
+		f.Delete(key)
+		return nil, nil
+	}
+	return session, nil
+}
+
+//save session
+func (f *UploadStore) Save(session *json.UploadSession) error {
+	//check
+	if session == nil || session.Key == "" {
+		return errors.New("invalid parameter")
+	}
+	data, err := session.EncodeSession()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.dir, f.path(session.Key), data)
+}
+
+//delete session by key
+func (f *UploadStore) Delete(key string) {
+	os.Remove(f.path(key))
+}
+
+////////////////
+//private func
+////////////////
+
+//get session file path
+func (f *UploadStore) path(key string) string {
+	return filepath.Join(f.dir, Md5Hex([]byte(key)) + UploadSessionExt)
+}
@@ -0,0 +1,123 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+	"time"
+)
+
+/*
+ * hedged reads
+ * - send same read to second node if first one is slow
+ * - first succeed answer wins, the other is canceled
+ * - hedge budget caps the extra load
+ * - canceled loser is not a failure, not logged or recorded as error
+ */
+
+//cancel cause of hedge loser
+var errHedgeLost = errors.New("hedge lost")
+
+//set read hedge para, nil means disable
+func (f *Client) SetReadHedge(para *face.HedgePara) {
+	f.Lock()
+	defer f.Unlock()
+	if para == nil {
+		f.hedger = nil
+		return
+	}
+	f.hedger = face.NewHedger(para)
+}
+
+////////////////
+//private func
+////////////////
+
+//read file by hedge if setup
+//node which served the read set into para
+func (f *Client) readByHedge(
+		ctx context.Context,
+		req *json.ReadFileReqJson,
+		para *callPara,
+	) (*json.ReadFileRespJson, error) {
+	type hedgeResult struct {
+		resp *json.ReadFileRespJson
+		node *face.OneNode
+		err error
+	}
+	f.RLock()
+	hedger := f.hedger
+	f.RUnlock()
+	if hedger == nil {
+		return do(ctx, f, opOfRead, req, json.NewReadFileRespJson, para)
+	}
+	hedger.OnRead()
+
+	//send read in son process
+	hedgeCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	resultChan := make(chan hedgeResult, 2)
+	sf := func(subPara *callPara) {
+		resp, err := do(hedgeCtx, f, opOfRead, req, json.NewReadFileRespJson, subPara)
+		resultChan <- hedgeResult{resp: resp, node: subPara.node, err: err}
+	}
+	pickChan := make(chan *face.OneNode, 1)
+	primaryPara := &callPara{
+		excludeTags: para.excludeTags,
+		onPick: func(node *face.OneNode) {
+			select {
+			case pickChan <- node:
+			default:
+			}
+		},
+	}
+	go sf(primaryPara)
+	running := 1
+
+	//wait primary node picked
+	var primaryNode *face.OneNode
+	select {
+	case primaryNode = <- pickChan:
+	case result := <- resultChan:
+		para.node = result.node
+		return result.resp, result.err
+	}
+
+	//wait result or hedge delay
+	var firstErr error
+	timer := time.NewTimer(hedger.GetDelay(primaryNode))
+	defer timer.Stop()
+	for running > 0 {
+		select {
+		case <- timer.C:
+			if !hedger.Allow() {
+				continue
+			}
+			running++
+			f.incHedge()
+			hedgePara := &callPara{
+				excludeTags: append(append([]string{}, para.excludeTags...), primaryNode.Tag),
+			}
+			go sf(hedgePara)
+		case result := <- resultChan:
+			running--
+			if result.err == nil {
+				para.node = result.node
+				//loser answers into buffered chan, never blocked
+				cancel(errHedgeLost)
+				return result.resp, nil
+			}
+			//no other node for hedge is not the read failure
+			if firstErr == nil || errors.Is(firstErr, face.ErrNoNode) {
+				firstErr = result.err
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+//check error of hedge loser canceled by winner
+func isHedgeLost(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil && errors.Is(context.Cause(ctx), errHedgeLost)
+}
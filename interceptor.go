@@ -0,0 +1,178 @@
+package tinyfs_client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"runtime/debug"
+	"time"
+)
+
+/*
+ * unary interceptor chain
+ * - run around every request, first added is outermost
+ * - packet meta in context travels to server, for auth headers etc.
+ */
+
+//unary invoker
+type UnaryInvoker func(ctx context.Context, op string, req interface{}) (interface{}, error)
+
+//unary interceptor
+type UnaryInterceptor func(
+	ctx context.Context,
+	op string,
+	req interface{},
+	invoker UnaryInvoker,
+) (interface{}, error)
+
+//packet meta context key
+type packetMetaKey struct{}
+
+//add interceptors
+func (f *Client) AddInterceptor(interceptors ...UnaryInterceptor) {
+	f.Lock()
+	defer f.Unlock()
+	for _, v := range interceptors {
+		if v != nil {
+			f.interceptors = append(f.interceptors, v)
+		}
+	}
+}
+
+//attach packet meta into context
+//reserved keys like codec and frame are ignored
+func WithPacketMeta(ctx context.Context, key, val string) context.Context {
+	if isReservedMeta(key) {
+		return ctx
+	}
+	meta := map[string]string{}
+	if old, ok := ctx.Value(packetMetaKey{}).(map[string]string); ok {
+		for k, v := range old {
+			meta[k] = v
+		}
+	}
+	meta[key] = val
+	return context.WithValue(ctx, packetMetaKey{}, meta)
+}
+
+//get packet meta from context
+func GetPacketMeta(ctx context.Context) map[string]string {
+	meta, _ := ctx.Value(packetMetaKey{}).(map[string]string)
+	return meta
+}
+
+//get packet meta key of context, empty if no meta
+func packetMetaKeyOf(ctx context.Context) string {
+	meta := GetPacketMeta(ctx)
+	if len(meta) <= 0 {
+		return ""
+	}
+	values := url.Values{}
+	for key, val := range meta {
+		values.Set(key, val)
+	}
+	return "|" + values.Encode()
+}
+
+//logging interceptor
+//log failed calls and calls slower than threshold, zero threshold means no slow log
+//nil logger means slog default logger
+func LoggingInterceptor(logger *slog.Logger, slowThreshold time.Duration) UnaryInterceptor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(
+			ctx context.Context,
+			op string,
+			req interface{},
+			invoker UnaryInvoker,
+		) (interface{}, error) {
+		begin := time.Now()
+		resp, err := invoker(ctx, op, req)
+		cost := time.Since(begin)
+		if isHedgeLost(ctx, err) {
+			logger.LogAttrs(ctx, slog.LevelDebug, "tinyfs hedge lost",
+				slog.String(LogKeyOfOp, op),
+				slog.String(LogKeyOfShortUrl, logShortUrl(req)),
+				slog.Duration(LogKeyOfCost, cost))
+		}else if err != nil {
+			logger.LogAttrs(ctx, slog.LevelError, "tinyfs call failed",
+				slog.String(LogKeyOfOp, op),
+				slog.String(LogKeyOfShortUrl, logShortUrl(req)),
+				slog.String(LogKeyOfCode, errLabel(err)),
+				slog.Duration(LogKeyOfCost, cost),
+				slog.Any(LogKeyOfErr, err))
+		}else if slowThreshold > 0 && cost >= slowThreshold {
+			logger.LogAttrs(ctx, slog.LevelWarn, "tinyfs call slow",
+				slog.String(LogKeyOfOp, op),
+				slog.String(LogKeyOfShortUrl, logShortUrl(req)),
+				slog.Duration(LogKeyOfCost, cost))
+		}
+		return resp, err
+	}
+}
+
+//timing interceptor
+//cb called with cost of every call
+func TimingInterceptor(cb func(op string, cost time.Duration, err error)) UnaryInterceptor {
+	return func(
+			ctx context.Context,
+			op string,
+			req interface{},
+			invoker UnaryInvoker,
+		) (interface{}, error) {
+		begin := time.Now()
+		resp, err := invoker(ctx, op, req)
+		if cb != nil {
+			cb(op, time.Since(begin), err)
+		}
+		return resp, err
+	}
+}
+
+//panic recovery interceptor
+//panic of inner interceptors and request converted into error
+//nil logger means slog default logger
+func RecoveryInterceptor(logger *slog.Logger) UnaryInterceptor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(
+			ctx context.Context,
+			op string,
+			req interface{},
+			invoker UnaryInvoker,
+		) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "tinyfs call panic",
+					slog.String(LogKeyOfOp, op),
+					slog.Any(LogKeyOfErr, r),
+					slog.String("stack", string(debug.Stack())))
+				resp = nil
+				err = fmt.Errorf("%w, op:%v, err:%v", ErrPanic, op, r)
+			}
+		}()
+		return invoker(ctx, op, req)
+	}
+}
+
+////////////////
+//private func
+////////////////
+
+//chain interceptors around invoker
+func (f *Client) chainInterceptors(invoker UnaryInvoker) UnaryInvoker {
+	f.RLock()
+	interceptors := f.interceptors
+	f.RUnlock()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor := interceptors[i]
+		next := invoker
+		invoker = func(ctx context.Context, op string, req interface{}) (interface{}, error) {
+			return interceptor(ctx, op, req, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,478 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/tracing"
+	"github.com/andyzhou/tinyrpc/proto"
+	"time"
+)
+
+/*
+ * generic request pipeline
+ * - pick node, encode, gen packet, send, check code and decode
+ * - single place for interceptors, retries and other plug-ins
+ */
+
+//one operation
+type operation struct {
+	name string
+	msgId int32
+	capability string //required capability, empty means no check
+	idempotent bool //safe to retry on other node
+	class string //rate limit class, empty means no limit
+	payload bool //cost grows with file size, latency not comparable
+}
+
+//inter operations
+var (
+	opOfRead = &operation{
+		name: "read",
+		msgId: define.MessageIdOfRead,
+		capability: define.CapOfRead,
+		idempotent: true,
+		class: face.LimitClassOfRead,
+		payload: true,
+	}
+	opOfMultiRead = &operation{
+		name: "multiRead",
+		msgId: define.MessageIdOfMultiRead,
+		capability: define.CapOfMultiRead,
+		idempotent: true,
+		class: face.LimitClassOfRead,
+		payload: true,
+	}
+	opOfWrite = &operation{
+		name: "write",
+		msgId: define.MessageIdOfWrite,
+		capability: define.CapOfWrite,
+		class: face.LimitClassOfWrite,
+		payload: true,
+	}
+	opOfRemove = &operation{
+		name: "remove",
+		msgId: define.MessageIdOfRemove,
+		capability: define.CapOfRemove,
+		idempotent: true,
+		class: face.LimitClassOfWrite,
+	}
+	opOfDelete = &operation{
+		name: "delete",
+		msgId: define.MessageIdOfDelete,
+		capability: define.CapOfDelete,
+		idempotent: true,
+		class: face.LimitClassOfWrite,
+	}
+	opOfListFile = &operation{
+		name: "listFile",
+		msgId: define.MessageIdOfListFile,
+		capability: define.CapOfListFile,
+		idempotent: true,
+		class: face.LimitClassOfList,
+	}
+	opOfUploadStart = &operation{
+		name: "uploadStart",
+		msgId: define.MessageIdOfUploadStart,
+		capability: define.CapOfChunkUpload,
+		class: face.LimitClassOfWrite,
+	}
+	opOfUploadPart = &operation{
+		name: "uploadPart",
+		msgId: define.MessageIdOfUploadPart,
+		capability: define.CapOfChunkUpload,
+		idempotent: true,
+		class: face.LimitClassOfWrite,
+		payload: true,
+	}
+	opOfUploadStatus = &operation{
+		name: "uploadStatus",
+		msgId: define.MessageIdOfUploadStatus,
+		capability: define.CapOfChunkUpload,
+		idempotent: true,
+		class: face.LimitClassOfRead,
+	}
+	opOfUploadCommit = &operation{
+		name: "uploadCommit",
+		msgId: define.MessageIdOfUploadCommit,
+		capability: define.CapOfChunkUpload,
+		class: face.LimitClassOfWrite,
+		payload: true,
+	}
+	opOfLookupDigest = &operation{
+		name: "lookupDigest",
+		msgId: define.MessageIdOfLookupDigest,
+		capability: define.CapOfLookupDigest,
+		idempotent: true,
+		class: face.LimitClassOfRead,
+	}
+)
+
+//call para
+type callPara struct {
+	excludeTags []string //nodes skipped by picking
+	addr string //pinned node address, retried on same node
+	node *face.OneNode //node which served the call, set by pipeline
+	onPick func(node *face.OneNode) //optional, called when node picked
+}
+
+//set max retries of idempotent operations
+//transport failure retried on other node
+func (f *Client) SetMaxRetries(retries int) error {
+	if retries < 0 {
+		return errors.New("invalid parameter")
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.maxRetries = retries
+	return nil
+}
+
+////////////////
+//private func
+////////////////
+
+//do one request with typed request and response
+func do[Req any, Resp any](
+		ctx context.Context,
+		f *Client,
+		op *operation,
+		req Req,
+		newResp func() Resp,
+		paras ...*callPara,
+	) (Resp, error) {
+	var (
+		para *callPara
+	)
+	if len(paras) > 0 && paras[0] != nil {
+		para = paras[0]
+	}else{
+		para = &callPara{}
+	}
+	invoker := func(subCtx context.Context, opName string, subReq interface{}) (interface{}, error) {
+		return f.invoke(subCtx, op, subReq, func() interface{} { return newResp() }, para)
+	}
+	val, err := f.chainInterceptors(invoker)(ctx, op.name, req)
+	if err != nil {
+		var empty Resp
+		return empty, err
+	}
+	resp, ok := val.(Resp)
+	if !ok {
+		var empty Resp
+		return empty, &RespTypeError{
+			Op: op.name,
+			Expect: fmt.Sprintf("%T", empty),
+			Actual: fmt.Sprintf("%T", val),
+		}
+	}
+	return resp, nil
+}
+
+//invoke one request, retry idempotent operation on other node
+func (f *Client) invoke(
+		ctx context.Context,
+		op *operation,
+		req interface{},
+		newResp func() interface{},
+		para *callPara,
+	) (resp interface{}, err error) {
+	var (
+		lastErr error
+	)
+	f.beginCall()
+	defer func() {
+		if isHedgeLost(ctx, err) {
+			f.endCall(nil)
+			return
+		}
+		f.endCall(err)
+	}()
+	f.RLock()
+	retries := f.maxRetries
+	f.RUnlock()
+	if !op.idempotent {
+		retries = 0
+	}
+
+	//start request span
+	ctx, span := f.getTracer().Start(ctx, "tinyfs." + op.name)
+	defer span.End()
+	span.SetAttr(tracing.AttrOfOp, op.name)
+	span.SetAttr(tracing.AttrOfMessageId, op.msgId)
+
+	//take client budget
+	releaseClient, err := f.acquireClientLimit(ctx, op)
+	if err != nil {
+		span.SetAttr(tracing.AttrOfErrorCode, errLabel(err))
+		span.SetError(err)
+		return nil, err
+	}
+	defer releaseClient()
+
+	excludeTags := append([]string{}, para.excludeTags...)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			f.incRetry()
+		}
+		//pick active node
+		node, err := f.pickCallNode(para, excludeTags)
+		if err != nil {
+			if lastErr == nil {
+				lastErr = err
+			}
+			break
+		}
+		para.node = node
+		if para.onPick != nil {
+			para.onPick(node)
+		}
+
+		//take node budget
+		releaseNode, err := f.acquireNodeLimit(ctx, node, op)
+		if err != nil {
+			node.Unhold()
+			lastErr = err
+			break
+		}
+		doneAdaptive, err := f.acquireAdaptive(ctx, node, op)
+		if err != nil {
+			releaseNode()
+			node.Unhold()
+			lastErr = err
+			break
+		}
+
+		//run one attempt
+		begin := time.Now()
+		resp, err := f.attempt(ctx, node, op, req, newResp, attempt)
+		doneAdaptive(time.Since(begin), err)
+		releaseNode()
+		node.Unhold()
+		if err == nil {
+			span.SetAttr(tracing.AttrOfNode, node.Address)
+			span.SetAttr(tracing.AttrOfAttempt, attempt)
+			return resp, nil
+		}
+		lastErr = err
+		if !f.isRetryable(ctx, err) {
+			break
+		}
+		if attempt < retries {
+			f.getLogger().Warn("tinyfs attempt failed, retry on other node",
+				LogKeyOfOp, op.name,
+				LogKeyOfNode, node.Address,
+				LogKeyOfShortUrl, logShortUrl(req),
+				LogKeyOfAttempt, attempt,
+				LogKeyOfErr, err)
+		}
+		excludeTags = append(excludeTags, node.Tag)
+	}
+	span.SetAttr(tracing.AttrOfErrorCode, errLabel(lastErr))
+	span.SetError(lastErr)
+	return nil, lastErr
+}
+
+//run one attempt on target node
+func (f *Client) attempt(
+		ctx context.Context,
+		node *face.OneNode,
+		op *operation,
+		req interface{},
+		newResp func() interface{},
+		attempt int,
+	) (respObj interface{}, err error) {
+	var (
+		bytesIn, bytesOut int
+	)
+	//start attempt span
+	ctx, span := f.getTracer().Start(ctx, "tinyfs." + op.name + ".attempt")
+	span.SetAttr(tracing.AttrOfOp, op.name)
+	span.SetAttr(tracing.AttrOfNode, node.Address)
+	span.SetAttr(tracing.AttrOfMessageId, op.msgId)
+	span.SetAttr(tracing.AttrOfAttempt, attempt)
+
+	//observe attempt
+	begin := time.Now()
+	node.BeginRequest()
+	defer func() {
+		cost := time.Since(begin)
+		code := ""
+		lost := isHedgeLost(ctx, err)
+		if err != nil && !lost {
+			code = errLabel(err)
+		}
+		node.EndRequest(cost, code, err)
+		if err == nil && op == opOfRead {
+			node.AddReadLatency(cost)
+		}
+		if err != nil && !lost {
+			f.addErrorRecord(ErrorRecord{
+				Time: time.Now(),
+				Op: op.name,
+				Node: node.Address,
+				ShortUrl: logShortUrl(req),
+				Code: code,
+				Err: err.Error(),
+			})
+		}
+		//hedge loser canceled by winner, not an error of node
+		observeErr := err
+		if lost {
+			observeErr = nil
+		}
+		f.observeAttempt(op, node, cost, bytesIn, bytesOut, observeErr)
+		span.SetAttr(tracing.AttrOfPayloadSize, bytesOut + bytesIn)
+		if err != nil {
+			span.SetAttr(tracing.AttrOfErrorCode, errLabel(err))
+			span.SetError(err)
+		}
+		span.End()
+	}()
+
+	//check capability
+	if op.capability != "" {
+		if err = f.checkCap(node, op.capability); err != nil {
+			return nil, err
+		}
+	}
+
+	//gen packet
+	pack := node.Client.GenPacket()
+	pack.MessageId = op.msgId
+	for key, val := range GetPacketMeta(ctx) {
+		setCallerPacketMeta(pack, key, val)
+	}
+	traceMeta := map[string]string{}
+	span.Inject(traceMeta)
+	for key, val := range traceMeta {
+		setCallerPacketMeta(pack, key, val)
+	}
+
+	//encode request obj
+	err = f.encodePacket(node, pack, req)
+	if err != nil {
+		return nil, fmt.Errorf("%v encode failed, %w", op.name, err)
+	}
+	bytesOut = len(pack.Data)
+
+	//send request to target node
+	resp, err := f.sendPacket(ctx, node, pack)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &TransportError{Op: op.name, Addr: node.Address, Err: err}
+	}
+	bytesIn = len(resp.Data)
+	err = codeError(op.name, resp.ErrCode, resp.ErrMsg)
+	if err != nil {
+		f.getLogger().Debug("tinyfs server refused request",
+			LogKeyOfOp, op.name,
+			LogKeyOfNode, node.Address,
+			LogKeyOfShortUrl, logShortUrl(req),
+			LogKeyOfCode, resp.ErrCode)
+		return nil, err
+	}
+
+	//decode origin resp
+	respObj = newResp()
+	if len(resp.Data) <= 0 {
+		return respObj, nil
+	}
+	err = f.decodePacket(resp, respObj)
+	if err != nil {
+		return nil, fmt.Errorf("%v decode failed, %w", op.name, err)
+	}
+	return respObj, nil
+}
+
+//check error retryable
+func (f *Client) isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
+
+//pick active node and hold it, Unhold when attempt done
+//nodes with exclude tags will be skipped
+func (f *Client) pickNode(excludeTags ...string) (*face.OneNode, error) {
+	node, err := f.node.PickAndHold(excludeTags...)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, face.ErrNoNode
+	}
+	if node.Client == nil {
+		node.Unhold()
+		return nil, errors.New("node client not init")
+	}
+	return node, nil
+}
+
+//pick node of call, pinned node first
+//picked node is held, draining pinned node means no node
+func (f *Client) pickCallNode(
+		para *callPara,
+		excludeTags []string,
+	) (*face.OneNode, error) {
+	if para.addr == "" {
+		return f.pickNode(excludeTags...)
+	}
+	node, err := f.node.GetNodeByAddr(para.addr)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil || !node.Hold() {
+		return nil, face.ErrNoNode
+	}
+	if node.Client == nil {
+		node.Unhold()
+		return nil, errors.New("node client not init")
+	}
+	return node, nil
+}
+
+//send packet to node with context
+//return early when context done
+func (f *Client) sendPacket(
+		ctx context.Context,
+		node *face.OneNode,
+		pack *proto.Packet,
+	) (*proto.Packet, error) {
+	type sendResult struct {
+		resp *proto.Packet
+		err error
+	}
+	//check
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	//send in son process
+	//node held until request off wire, drain waits for it
+	resultChan := make(chan sendResult, 1)
+	node.Retain()
+	go func() {
+		defer node.Unhold()
+		resp, err := node.Client.SendRequest(pack)
+		f.releasePacket(pack)
+		if err == nil && resp == nil {
+			err = errors.New("empty response packet")
+		}
+		resultChan <- sendResult{resp: resp, err: err}
+	}()
+
+	//wait result or context done
+	select {
+	case result := <- resultChan:
+		return result.resp, result.err
+	case <- ctx.Done():
+		return nil, ctx.Err()
+	}
+}
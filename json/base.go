@@ -4,8 +4,7 @@ package json
 import (
 	"encoding/json"
 	"errors"
-	"log"
-	"runtime/debug"
+	"fmt"
 )
 
 /*
@@ -53,12 +52,7 @@ func (j *BaseJson) Decode(data []byte, i interface{}) error {
 	//try decode json data
 	err := json.Unmarshal(data, i)
 	if err != nil {
-		//log.Println("BaseJson::Decode, decode failed, err:", err.Error())
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Printf("syntax error at byte offset %d", e.Offset)
-		}
-		log.Println("BaseJson::Decode, track:", string(debug.Stack()))
-		return err
+		return wrapSyntaxError(err)
 	}
 	return nil
 }
@@ -71,10 +65,7 @@ func (j *BaseJson) EncodeSimple(data map[string]interface{}) ([]byte, error) {
 	//try encode json data
 	byte, err := json.Marshal(data)
 	if err != nil {
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Printf("syntax error at byte offset %d", e.Offset)
-		}
-		return nil, err
+		return nil, wrapSyntaxError(err)
 	}
 	return byte, nil
 }
@@ -87,11 +78,16 @@ func (j *BaseJson) DecodeSimple(data []byte, kv map[string]interface{}) error {
 	//try decode json data
 	err := json.Unmarshal(data, &kv)
 	if err != nil {
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Printf("syntax error at byte offset %d", e.Offset)
-		}
-		log.Printf("sakura response: %q", data)
-		return err
+		return wrapSyntaxError(err)
 	}
 	return nil
 }
+
+//wrap syntax error with byte offset
+//raw data never attached, it may hold file content
+func wrapSyntaxError(err error) error {
+	if e, ok := err.(*json.SyntaxError); ok {
+		return fmt.Errorf("syntax error at byte offset %d, %w", e.Offset, err)
+	}
+	return err
+}
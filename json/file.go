@@ -12,7 +12,8 @@ type FileInfo struct {
 	Type      string `json:"type"`
 	Size      int64  `json:"size"`
 	Md5       string `json:"md5"`
-	ChunkNode string `json:"chunkNode"` //chunk node tag
+	Sha256    string `json:"sha256,omitempty"` //optional digest
+	ChunkNode string `json:"chunkNode"`        //chunk node tag
 	CreateAt  int64  `json:"createAt"`
 	BaseJson
 }
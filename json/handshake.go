@@ -0,0 +1,36 @@
+package json
+
+/*
+ * handshake json
+ */
+
+//protocol handshake
+type HandshakeReqJson struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+	Codecs       []string `json:"codecs"`
+	BaseJson
+}
+
+type HandshakeRespJson struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+	Codecs       []string `json:"codecs"`
+	BaseJson
+}
+
+//construct
+func NewHandshakeReqJson() *HandshakeReqJson {
+	this := &HandshakeReqJson{
+		Capabilities: []string{},
+		Codecs: []string{},
+	}
+	return this
+}
+func NewHandshakeRespJson() *HandshakeRespJson {
+	this := &HandshakeRespJson{
+		Capabilities: []string{},
+		Codecs: []string{},
+	}
+	return this
+}
@@ -4,6 +4,12 @@ package json
  * file request json
  */
 
+//progress callback, done and total in bytes
+//total is -1 while unknown
+//granularity depends on request, see fields using it
+//single file read has no progress, data comes in one message
+type ProgressFunc func(done, total int64)
+
 //list files
 type ListFileReqJson struct {
 	Page     int `json:"page"`
@@ -36,16 +42,19 @@ type ReadFileReqJson struct {
 }
 
 type ReadFileRespJson struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-	Size int64  `json:"size"`
-	Data []byte `json:"data"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	Md5    string `json:"md5"`              //stored digest of whole file
+	Sha256 string `json:"sha256,omitempty"` //optional stored digest
+	Data   []byte `json:"data"`
 	BaseJson
 }
 
 //read multi files
 type ReadMultiFilesReqJson struct {
-	ShortUrls []string `json:"shortUrls"`
+	ShortUrls []string     `json:"shortUrls"`
+	Progress  ProgressFunc `json:"-"` //optional, local only, per file not per byte
 	BaseJson
 }
 
@@ -56,10 +65,13 @@ type ReadMultiFilesRespJson struct {
 
 //write file
 type WriteFileReqJson struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-	Size int64  `json:"size"`
-	Data []byte `json:"data"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Size     int64        `json:"size"`
+	Md5      string       `json:"md5"`              //digest of data
+	Sha256   string       `json:"sha256,omitempty"` //optional digest of data
+	Data     []byte       `json:"data"`
+	Progress ProgressFunc `json:"-"` //optional, local only, per admitted chunk
 	BaseJson
 }
 
@@ -68,6 +80,22 @@ type WriteFileRespJson struct {
 	BaseJson
 }
 
+//lookup file by digest
+type LookupDigestReqJson struct {
+	Md5    string `json:"md5"`
+	Sha256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+	Name   string `json:"name"`
+	BaseJson
+}
+
+type LookupDigestRespJson struct {
+	Exists   bool   `json:"exists"`
+	ShortUrl string `json:"shortUrl"`
+	Name     string `json:"name"`
+	BaseJson
+}
+
 //construct
 func NewListFileReqJson() *ListFileReqJson {
 	this := &ListFileReqJson{
@@ -103,6 +131,15 @@ func NewWriteFileRespJson() *WriteFileRespJson {
 	return this
 }
 
+func NewLookupDigestReqJson() *LookupDigestReqJson {
+	this := &LookupDigestReqJson{}
+	return this
+}
+func NewLookupDigestRespJson() *LookupDigestRespJson {
+	this := &LookupDigestRespJson{}
+	return this
+}
+
 func NewReadFileReqJson() *ReadFileReqJson {
 	this := &ReadFileReqJson{}
 	return this
@@ -125,4 +162,18 @@ func NewReadMultiFilesRespJson() *ReadMultiFilesRespJson {
 		Files: map[string]*ReadFileRespJson{},
 	}
 	return this
-}
\ No newline at end of file
+}
+//payload carrier
+func (j *ReadFileRespJson) GetPayload() []byte {
+	return j.Data
+}
+func (j *ReadFileRespJson) SetPayload(data []byte) {
+	j.Data = data
+}
+
+func (j *WriteFileReqJson) GetPayload() []byte {
+	return j.Data
+}
+func (j *WriteFileReqJson) SetPayload(data []byte) {
+	j.Data = data
+}
@@ -0,0 +1,179 @@
+package json
+
+import (
+	"sync"
+)
+
+/*
+ * chunked upload json
+ */
+
+//start upload session
+type UploadStartReqJson struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"partSize"`
+	Parts    int    `json:"parts"`
+	Md5      string `json:"md5"`              //digest of whole file
+	Sha256   string `json:"sha256,omitempty"` //optional digest of whole file
+	BaseJson
+}
+
+type UploadStartRespJson struct {
+	UploadId string `json:"uploadId"`
+	BaseJson
+}
+
+//upload one part, part number from 0
+type UploadPartReqJson struct {
+	UploadId string `json:"uploadId"`
+	PartNo   int    `json:"partNo"`
+	Md5      string `json:"md5"` //digest of part
+	Data     []byte `json:"data"`
+	BaseJson
+}
+
+type UploadPartRespJson struct {
+	PartNo int    `json:"partNo"`
+	Md5    string `json:"md5"`
+	BaseJson
+}
+
+//query received parts
+type UploadStatusReqJson struct {
+	UploadId string `json:"uploadId"`
+	BaseJson
+}
+
+type UploadStatusRespJson struct {
+	UploadId string `json:"uploadId"`
+	Parts    []int  `json:"parts"` //received part numbers
+	BaseJson
+}
+
+//commit upload session
+type UploadCommitReqJson struct {
+	UploadId string `json:"uploadId"`
+	Parts    int    `json:"parts"`
+	Md5      string `json:"md5"`
+	Sha256   string `json:"sha256,omitempty"`
+	BaseJson
+}
+
+type UploadCommitRespJson struct {
+	ShortUrl string `json:"shortUrl"`
+	Md5      string `json:"md5"`              //digest of assembled file
+	Sha256   string `json:"sha256,omitempty"` //optional digest of assembled file
+	BaseJson
+}
+
+//local upload session, persisted for resume
+type UploadSession struct {
+	Key      string `json:"key"` //local session key
+	UploadId string `json:"uploadId"`
+	Addr     string `json:"addr"` //node which holds the session
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"partSize"`
+	Parts    int    `json:"parts"`
+	Md5      string `json:"md5"`
+	Sha256   string `json:"sha256,omitempty"`
+	Done     []int  `json:"done"` //uploaded part numbers
+	CreateAt int64  `json:"createAt"`
+	locker   sync.Mutex
+	BaseJson
+}
+
+//construct
+func NewUploadStartReqJson() *UploadStartReqJson {
+	this := &UploadStartReqJson{}
+	return this
+}
+func NewUploadStartRespJson() *UploadStartRespJson {
+	this := &UploadStartRespJson{}
+	return this
+}
+
+func NewUploadPartReqJson() *UploadPartReqJson {
+	this := &UploadPartReqJson{}
+	return this
+}
+func NewUploadPartRespJson() *UploadPartRespJson {
+	this := &UploadPartRespJson{}
+	return this
+}
+
+func NewUploadStatusReqJson() *UploadStatusReqJson {
+	this := &UploadStatusReqJson{}
+	return this
+}
+func NewUploadStatusRespJson() *UploadStatusRespJson {
+	this := &UploadStatusRespJson{
+		Parts: []int{},
+	}
+	return this
+}
+
+func NewUploadCommitReqJson() *UploadCommitReqJson {
+	this := &UploadCommitReqJson{}
+	return this
+}
+func NewUploadCommitRespJson() *UploadCommitRespJson {
+	this := &UploadCommitRespJson{}
+	return this
+}
+
+func NewUploadSession() *UploadSession {
+	this := &UploadSession{
+		Done: []int{},
+	}
+	return this
+}
+
+//payload carrier
+func (j *UploadPartReqJson) GetPayload() []byte {
+	return j.Data
+}
+func (j *UploadPartReqJson) SetPayload(data []byte) {
+	j.Data = data
+}
+
+//check part uploaded
+func (j *UploadSession) HasPart(partNo int) bool {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+	for _, v := range j.Done {
+		if v == partNo {
+			return true
+		}
+	}
+	return false
+}
+
+//mark part uploaded
+func (j *UploadSession) MarkDone(partNo int) {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+	for _, v := range j.Done {
+		if v == partNo {
+			return
+		}
+	}
+	j.Done = append(j.Done, partNo)
+}
+
+//reset uploaded parts
+func (j *UploadSession) SetDone(parts []int) {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+	j.Done = append([]int{}, parts...)
+}
+
+//encode session, safe with concurrent part updates
+func (j *UploadSession) EncodeSession() ([]byte, error) {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+	return j.Encode(j)
+}
@@ -0,0 +1,95 @@
+package tinyfs_client
+
+import (
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/json"
+	"log/slog"
+	"strings"
+)
+
+/*
+ * structured leveled logging
+ * - all client and node logs go through one slog logger
+ * - fields are node, op, shortUrl and code
+ * - file content never logged
+ */
+
+//log field keys
+const (
+	LogKeyOfNode = "node"
+	LogKeyOfOp = "op"
+	LogKeyOfShortUrl = "shortUrl"
+	LogKeyOfCode = "code"
+	LogKeyOfCost = "cost"
+	LogKeyOfAttempt = "attempt"
+	LogKeyOfErr = "err"
+)
+
+const (
+	LogMaxShortUrls = 5 //short urls of multi file request logged
+)
+
+//set logger, nil means slog default logger
+func (f *Client) SetLogger(logger *slog.Logger) {
+	f.Lock()
+	f.logger = logger
+	f.Unlock()
+	f.node.SetLogger(logger)
+}
+
+////////////////
+//private func
+////////////////
+
+//get logger
+func (f *Client) getLogger() *slog.Logger {
+	f.RLock()
+	defer f.RUnlock()
+	if f.logger == nil {
+		return slog.Default()
+	}
+	return f.logger
+}
+
+//get short url of request for log field
+//only keys of request, never data
+//write request logged by file name
+func logShortUrl(req interface{}) string {
+	switch v := req.(type) {
+	case *json.ReadFileReqJson:
+		if v != nil {
+			return v.ShortUrl
+		}
+	case *json.ReadMultiFilesReqJson:
+		if v != nil {
+			return joinShortUrls(v.ShortUrls)
+		}
+	case *json.DeleteFileReqJson:
+		if v != nil {
+			return joinShortUrls(v.ShortUrls)
+		}
+	case *json.RemoveFileReqJson:
+		if v != nil {
+			return joinShortUrls(v.ShortUrls)
+		}
+	case *json.WriteFileReqJson:
+		if v != nil {
+			return v.Name
+		}
+	case *json.UploadStartReqJson:
+		if v != nil {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+//join first short urls, rest counted only
+func joinShortUrls(shortUrls []string) string {
+	if len(shortUrls) <= LogMaxShortUrls {
+		return strings.Join(shortUrls, ",")
+	}
+	return fmt.Sprintf("%v,+%v more",
+		strings.Join(shortUrls[:LogMaxShortUrls], ","),
+		len(shortUrls) - LogMaxShortUrls)
+}
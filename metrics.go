@@ -0,0 +1,111 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/face"
+	"strconv"
+	"time"
+)
+
+/*
+ * metrics instrumentation
+ * - every request attempt reported to sink by op and node
+ * - node events reported as reconnect count and healthy node count
+ */
+
+//metrics sink interface
+type MetricsSink interface {
+	IncRequest(op, node string)
+	ObserveLatency(op, node string, cost time.Duration)
+	AddBytes(op, node string, in, out int)
+	IncError(op, node, code string)
+	IncReconnect(node string)
+	SetHealthyNodes(num int)
+}
+
+//error code label of client side errors
+const (
+	ErrLabelOfTransport = "transport"
+	ErrLabelOfCanceled = "canceled"
+	ErrLabelOfUnsupported = "unsupported"
+	ErrLabelOfClient = "client"
+	ErrLabelOfRateLimited = "rateLimited"
+)
+
+//set metrics sink, nil means disable
+func (f *Client) SetMetricsSink(sink MetricsSink) {
+	f.Lock()
+	f.metricsSink = sink
+	f.Unlock()
+	if sink != nil {
+		sink.SetHealthyNodes(f.node.GetHealthyCount())
+	}
+}
+
+////////////////
+//private func
+////////////////
+
+//get metrics sink
+func (f *Client) getMetricsSink() MetricsSink {
+	f.RLock()
+	defer f.RUnlock()
+	return f.metricsSink
+}
+
+//observe one request attempt
+func (f *Client) observeAttempt(
+		op *operation,
+		node *face.OneNode,
+		cost time.Duration,
+		bytesIn, bytesOut int,
+		err error,
+	) {
+	sink := f.getMetricsSink()
+	if sink == nil {
+		return
+	}
+	sink.IncRequest(op.name, node.Address)
+	sink.ObserveLatency(op.name, node.Address, cost)
+	sink.AddBytes(op.name, node.Address, bytesIn, bytesOut)
+	if err != nil {
+		sink.IncError(op.name, node.Address, errLabel(err))
+	}
+}
+
+//cb for node event
+func (f *Client) cbForNodeEvent(event int, addr string) {
+	if event == face.NodeEventOfDel {
+		f.dropNodeLimits()
+	}
+	sink := f.getMetricsSink()
+	if sink == nil {
+		return
+	}
+	if event == face.NodeEventOfReconnect {
+		sink.IncReconnect(addr)
+	}
+	sink.SetHealthyNodes(f.node.GetHealthyCount())
+}
+
+//get error label
+func errLabel(err error) string {
+	var (
+		codeErr *CodeError
+		transportErr *TransportError
+	)
+	switch {
+	case errors.As(err, &codeErr):
+		return strconv.Itoa(int(codeErr.Code))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrLabelOfCanceled
+	case errors.As(err, &transportErr):
+		return ErrLabelOfTransport
+	case errors.Is(err, ErrUnsupported):
+		return ErrLabelOfUnsupported
+	case errors.Is(err, ErrRateLimited):
+		return ErrLabelOfRateLimited
+	}
+	return ErrLabelOfClient
+}
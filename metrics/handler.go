@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * prometheus text exposition handler
+ */
+const (
+	MetricsPrefix = "tinyfs_client_"
+	MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+//get http handler of mem sink
+func Handler(sink *MemSink) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MetricsContentType)
+		WriteText(w, sink.GetSnapshot())
+	})
+}
+
+//write snapshot in prometheus text format
+func WriteText(w io.Writer, snapshot *Snapshot) {
+	//requests
+	writeHead(w, "requests_total", "counter", "Total requests by op and node.")
+	for _, key := range sortedKeys(snapshot.Requests) {
+		parts := SplitKey(key)
+		fmt.Fprintf(w, "%vrequests_total{op=%v,node=%v} %v\n",
+			MetricsPrefix, quote(parts[0]), quote(parts[1]), snapshot.Requests[key])
+	}
+
+	//latency
+	writeHead(w, "request_duration_seconds", "histogram", "Request latency by op and node.")
+	latencyKeys := make([]string, 0, len(snapshot.Latency))
+	for key := range snapshot.Latency {
+		latencyKeys = append(latencyKeys, key)
+	}
+	sort.Strings(latencyKeys)
+	for _, key := range latencyKeys {
+		parts := SplitKey(key)
+		hist := snapshot.Latency[key]
+		labels := fmt.Sprintf("op=%v,node=%v", quote(parts[0]), quote(parts[1]))
+		for i, bound := range hist.Buckets {
+			fmt.Fprintf(w, "%vrequest_duration_seconds_bucket{%v,le=%v} %v\n",
+				MetricsPrefix, labels, quote(strconv.FormatFloat(bound, 'g', -1, 64)), hist.Counts[i])
+		}
+		fmt.Fprintf(w, "%vrequest_duration_seconds_bucket{%v,le=\"+Inf\"} %v\n",
+			MetricsPrefix, labels, hist.Count)
+		fmt.Fprintf(w, "%vrequest_duration_seconds_sum{%v} %v\n", MetricsPrefix, labels, hist.Sum)
+		fmt.Fprintf(w, "%vrequest_duration_seconds_count{%v} %v\n", MetricsPrefix, labels, hist.Count)
+	}
+
+	//bytes
+	writeHead(w, "bytes_total", "counter", "Total payload bytes by op, node and direction.")
+	for _, key := range sortedKeys(snapshot.BytesIn) {
+		parts := SplitKey(key)
+		fmt.Fprintf(w, "%vbytes_total{op=%v,node=%v,direction=\"in\"} %v\n",
+			MetricsPrefix, quote(parts[0]), quote(parts[1]), snapshot.BytesIn[key])
+		fmt.Fprintf(w, "%vbytes_total{op=%v,node=%v,direction=\"out\"} %v\n",
+			MetricsPrefix, quote(parts[0]), quote(parts[1]), snapshot.BytesOut[key])
+	}
+
+	//errors
+	writeHead(w, "errors_total", "counter", "Total errors by op, node and code.")
+	for _, key := range sortedKeys(snapshot.Errors) {
+		parts := SplitKey(key)
+		fmt.Fprintf(w, "%verrors_total{op=%v,node=%v,code=%v} %v\n",
+			MetricsPrefix, quote(parts[0]), quote(parts[1]), quote(parts[2]), snapshot.Errors[key])
+	}
+
+	//reconnects
+	writeHead(w, "reconnects_total", "counter", "Total reconnects by node.")
+	for _, key := range sortedKeys(snapshot.Reconnects) {
+		fmt.Fprintf(w, "%vreconnects_total{node=%v} %v\n",
+			MetricsPrefix, quote(key), snapshot.Reconnects[key])
+	}
+
+	//healthy nodes
+	writeHead(w, "healthy_nodes", "gauge", "Current healthy node count.")
+	fmt.Fprintf(w, "%vhealthy_nodes %v\n", MetricsPrefix, snapshot.HealthyNodes)
+}
+
+////////////////
+//private func
+////////////////
+
+//write metric head
+func writeHead(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %v%v %v\n", MetricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %v%v %v\n", MetricsPrefix, name, kind)
+}
+
+//quote label value
+func quote(val string) string {
+	val = strings.ReplaceAll(val, `\`, `\\`)
+	val = strings.ReplaceAll(val, "\n", `\n`)
+	val = strings.ReplaceAll(val, `"`, `\"`)
+	return `"` + val + `"`
+}
+
+//get sorted keys
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * in-memory metrics sink
+ * - request counts, latency histograms, bytes, errors by op and node
+ * - reconnect counts and healthy node count
+ */
+
+//default latency buckets in seconds
+var DefaultBuckets = []float64{
+	0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+//one histogram
+type Histogram struct {
+	Buckets []float64 `json:"buckets"` //upper bounds
+	Counts []int64 `json:"counts"` //cumulative counts
+	Sum float64 `json:"sum"`
+	Count int64 `json:"count"`
+}
+
+//metrics snapshot
+type Snapshot struct {
+	Requests map[string]int64 `json:"requests"` //op|node -> count
+	Latency map[string]*Histogram `json:"latency"` //op|node -> histogram
+	BytesIn map[string]int64 `json:"bytesIn"` //op|node -> bytes
+	BytesOut map[string]int64 `json:"bytesOut"` //op|node -> bytes
+	Errors map[string]int64 `json:"errors"` //op|node|code -> count
+	Reconnects map[string]int64 `json:"reconnects"` //node -> count
+	HealthyNodes int `json:"healthyNodes"`
+}
+
+//face info
+type MemSink struct {
+	buckets []float64
+	requests map[string]int64
+	latency map[string]*Histogram
+	bytesIn map[string]int64
+	bytesOut map[string]int64
+	errors map[string]int64
+	reconnects map[string]int64
+	healthyNodes int
+	sync.Mutex
+}
+
+//construct
+func NewMemSink(buckets ...float64) *MemSink {
+	if len(buckets) <= 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	this := &MemSink{
+		buckets: buckets,
+		requests: map[string]int64{},
+		latency: map[string]*Histogram{},
+		bytesIn: map[string]int64{},
+		bytesOut: map[string]int64{},
+		errors: map[string]int64{},
+		reconnects: map[string]int64{},
+	}
+	return this
+}
+
+//inc request count
+func (f *MemSink) IncRequest(op, node string) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests[JoinKey(op, node)]++
+}
+
+//observe request latency
+func (f *MemSink) ObserveLatency(op, node string, cost time.Duration) {
+	key := JoinKey(op, node)
+	seconds := cost.Seconds()
+	f.Lock()
+	defer f.Unlock()
+	hist, ok := f.latency[key]
+	if !ok {
+		hist = &Histogram{
+			Buckets: f.buckets,
+			Counts: make([]int64, len(f.buckets)),
+		}
+		f.latency[key] = hist
+	}
+	for i, bound := range hist.Buckets {
+		if seconds <= bound {
+			hist.Counts[i]++
+		}
+	}
+	hist.Sum += seconds
+	hist.Count++
+}
+
+//add bytes in and out
+func (f *MemSink) AddBytes(op, node string, in, out int) {
+	key := JoinKey(op, node)
+	f.Lock()
+	defer f.Unlock()
+	f.bytesIn[key] += int64(in)
+	f.bytesOut[key] += int64(out)
+}
+
+//inc error count
+func (f *MemSink) IncError(op, node, code string) {
+	f.Lock()
+	defer f.Unlock()
+	f.errors[JoinKey(op, node, code)]++
+}
+
+//inc reconnect count
+func (f *MemSink) IncReconnect(node string) {
+	f.Lock()
+	defer f.Unlock()
+	f.reconnects[node]++
+}
+
+//set healthy node count
+func (f *MemSink) SetHealthyNodes(num int) {
+	f.Lock()
+	defer f.Unlock()
+	f.healthyNodes = num
+}
+
+//get snapshot
+func (f *MemSink) GetSnapshot() *Snapshot {
+	f.Lock()
+	defer f.Unlock()
+	snapshot := &Snapshot{
+		Requests: copyMap(f.requests),
+		Latency: map[string]*Histogram{},
+		BytesIn: copyMap(f.bytesIn),
+		BytesOut: copyMap(f.bytesOut),
+		Errors: copyMap(f.errors),
+		Reconnects: copyMap(f.reconnects),
+		HealthyNodes: f.healthyNodes,
+	}
+	for k, v := range f.latency {
+		hist := *v
+		hist.Counts = append([]int64{}, v.Counts...)
+		snapshot.Latency[k] = &hist
+	}
+	return snapshot
+}
+
+//join key parts
+func JoinKey(parts ...string) string {
+	return strings.Join(parts, "|")
+}
+
+//split key parts
+func SplitKey(key string) []string {
+	return strings.Split(key, "|")
+}
+
+////////////////
+//private func
+////////////////
+
+//copy counter map
+func copyMap(m map[string]int64) map[string]int64 {
+	result := make(map[string]int64, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
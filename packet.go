@@ -0,0 +1,176 @@
+package tinyfs_client
+
+import (
+	"errors"
+	"github.com/andyzhou/tinyfs_client/codec"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyrpc/proto"
+	"net/url"
+)
+
+/*
+ * packet encode and decode
+ * - packet meta kept in packet act field as url query string
+ * - request codec name stamped into packet meta
+ * - response decoded by codec which server declared, json by default
+ * - optional raw frame, small header with raw payload trailer
+ * - frame meta marks request data frame, accept frame meta allows raw reply
+ * - codec and frame keys reserved, stripped from caller meta
+ */
+
+//set codec for request encoding
+//server should support it and reply with same codec
+func (f *Client) SetCodec(c codec.Codec) error {
+	//check
+	if c == nil || c.Name() == "" {
+		return errors.New("invalid parameter")
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.codec = c
+	return nil
+}
+
+//set raw frame switcher
+//payload of read and write messages kept out of codec encoding
+func (f *Client) SetRawFrame(enable bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.rawFrame = enable
+}
+
+//get current codec
+func (f *Client) GetCodec() codec.Codec {
+	f.RLock()
+	defer f.RUnlock()
+	return f.codec
+}
+
+////////////////
+//private func
+////////////////
+
+//encode request obj into packet
+//new codec and raw frame used only when node advertised them
+//raw frame data is pooled buffer, released after sent
+func (f *Client) encodePacket(
+		node *face.OneNode,
+		pack *proto.Packet,
+		req interface{},
+	) error {
+	f.RLock()
+	c := f.codec
+	rawFrame := f.rawFrame
+	f.RUnlock()
+	if !node.HasCodec(c.Name()) {
+		c = codec.NewJsonCodec()
+	}
+	if !node.HasCap(define.CapOfRawFrame) {
+		rawFrame = false
+	}
+	setPacketMeta(pack, define.PacketMetaOfCodec, c.Name())
+
+	//raw frame for payload carrier
+	carrier, ok := req.(codec.PayloadCarrier)
+	if rawFrame {
+		//server may reply with raw frame
+		setPacketMeta(pack, define.PacketMetaOfAcceptFrame, define.FrameOfRaw)
+	}
+	if rawFrame && ok {
+		header, err := c.Marshal(codec.CopyWithoutPayload(req))
+		if err != nil {
+			return err
+		}
+		pack.Data = codec.EncodeFrame(header, carrier.GetPayload())
+		setPacketMeta(pack, define.PacketMetaOfFrame, define.FrameOfRaw)
+		return nil
+	}
+
+	//general encode
+	data, err := c.Marshal(req)
+	if err != nil {
+		return err
+	}
+	pack.Data = data
+	return nil
+}
+
+//release pooled packet data after sent
+//only raw frame request data is pooled
+func (f *Client) releasePacket(pack *proto.Packet) {
+	if getPacketMeta(pack, define.PacketMetaOfFrame) != define.FrameOfRaw {
+		return
+	}
+	codec.PutBuffer(pack.Data)
+	pack.Data = nil
+}
+
+//decode response packet into obj
+func (f *Client) decodePacket(resp *proto.Packet, v interface{}) error {
+	//check
+	if resp == nil || v == nil {
+		return errors.New("invalid parameter")
+	}
+	name := getPacketMeta(resp, define.PacketMetaOfCodec)
+	if name == "" {
+		name = define.CodecOfJson
+	}
+	c, err := codec.Get(name)
+	if err != nil {
+		return err
+	}
+	if getPacketMeta(resp, define.PacketMetaOfFrame) != define.FrameOfRaw {
+		return c.Unmarshal(resp.Data, v)
+	}
+
+	//raw frame, payload refers to packet data
+	header, payload, err := codec.DecodeFrame(resp.Data)
+	if err != nil {
+		return err
+	}
+	err = c.Unmarshal(header, v)
+	if err != nil {
+		return err
+	}
+	if carrier, ok := v.(codec.PayloadCarrier); ok {
+		carrier.SetPayload(payload)
+	}
+	return nil
+}
+
+//check reserved packet meta key, set by client only
+func isReservedMeta(key string) bool {
+	switch key {
+	case define.PacketMetaOfCodec, define.PacketMetaOfFrame, define.PacketMetaOfAcceptFrame:
+		return true
+	}
+	return false
+}
+
+//set packet meta of caller or tracer, reserved keys stripped
+func setCallerPacketMeta(pack *proto.Packet, key, val string) {
+	if isReservedMeta(key) {
+		return
+	}
+	setPacketMeta(pack, key, val)
+}
+
+//set packet meta
+func setPacketMeta(pack *proto.Packet, key, val string) {
+	meta, _ := url.ParseQuery(pack.Act)
+	if meta == nil {
+		meta = url.Values{}
+	}
+	meta.Set(key, val)
+	pack.Act = meta.Encode()
+}
+
+//get packet meta
+func getPacketMeta(pack *proto.Packet, key string) string {
+	meta, err := url.ParseQuery(pack.Act)
+	if err != nil {
+		return ""
+	}
+	return meta.Get(key)
+}
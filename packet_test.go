@@ -0,0 +1,176 @@
+package tinyfs_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/codec"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+	"github.com/andyzhou/tinyrpc/proto"
+	"testing"
+)
+
+/*
+ * packet round trip test and benchmark
+ * - request encoded into packet, decoded as server echo
+ * - raw frame reply decoded with payload trailer
+ * - reserved meta of caller never reaches packet
+ */
+
+var (
+	benchPacketSizes = []int{1024 * 4, 1024 * 256, 1024 * 1024 * 4}
+)
+
+//gen write request with payload of size
+func genPacketWriteReq(size int) *json.WriteFileReqJson {
+	req := json.NewWriteFileReqJson()
+	req.Name = "bench.bin"
+	req.Size = int64(size)
+	req.Data = make([]byte, size)
+	for i := range req.Data {
+		req.Data[i] = byte(i)
+	}
+	return req
+}
+
+//gen raw frame reply packet of request
+func genFramePacket(req *json.WriteFileReqJson) (*proto.Packet, error) {
+	header, err := codec.NewJsonCodec().Marshal(codec.CopyWithoutPayload(req))
+	if err != nil {
+		return nil, err
+	}
+	pack := &proto.Packet{}
+	pack.Data = codec.EncodeFrame(header, req.Data)
+	setPacketMeta(pack, define.PacketMetaOfCodec, define.CodecOfJson)
+	setPacketMeta(pack, define.PacketMetaOfFrame, define.FrameOfRaw)
+	return pack, nil
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	client := &Client{
+		codec: codec.NewJsonCodec(),
+		rawFrame: true,
+	}
+	req := genPacketWriteReq(1024 * 8)
+
+	//node without raw frame capability gets json body
+	pack := &proto.Packet{}
+	err := client.encodePacket(&face.OneNode{}, pack, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getPacketMeta(pack, define.PacketMetaOfFrame) != "" ||
+		getPacketMeta(pack, define.PacketMetaOfAcceptFrame) != "" {
+		t.Fatalf("frame meta set without capability, act:%v", pack.Act)
+	}
+	echo := json.NewWriteFileReqJson()
+	err = client.decodePacket(pack, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if echo.Name != req.Name || !bytes.Equal(echo.Data, req.Data) {
+		t.Fatal("json body not matched")
+	}
+	client.releasePacket(pack)
+	if pack.Data == nil {
+		t.Fatal("json body released into pool")
+	}
+
+	//raw frame reply
+	pack, err = genFramePacket(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := json.NewReadFileRespJson()
+	err = client.decodePacket(pack, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.Data, req.Data) {
+		t.Fatal("frame payload not matched")
+	}
+}
+
+func TestPacketReservedMeta(t *testing.T) {
+	client := &Client{
+		codec: codec.NewJsonCodec(),
+	}
+	ctx := WithPacketMeta(context.Background(), define.PacketMetaOfFrame, define.FrameOfRaw)
+	ctx = WithPacketMeta(ctx, define.PacketMetaOfAcceptFrame, define.FrameOfRaw)
+	ctx = WithPacketMeta(ctx, "tenant", "t1")
+	meta := GetPacketMeta(ctx)
+	if len(meta) != 1 || meta["tenant"] != "t1" {
+		t.Fatalf("reserved meta kept in context, %v", meta)
+	}
+
+	//reserved keys from tracer stripped too
+	pack := &proto.Packet{}
+	setCallerPacketMeta(pack, define.PacketMetaOfFrame, define.FrameOfRaw)
+	setCallerPacketMeta(pack, define.PacketMetaOfCodec, "gob")
+	err := client.encodePacket(&face.OneNode{}, pack, genPacketWriteReq(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getPacketMeta(pack, define.PacketMetaOfFrame) != "" ||
+		getPacketMeta(pack, define.PacketMetaOfCodec) != define.CodecOfJson {
+		t.Fatalf("reserved meta overwritten, act:%v", pack.Act)
+	}
+	client.releasePacket(pack)
+	if pack.Data == nil {
+		t.Fatal("json body released into pool")
+	}
+}
+
+func BenchmarkPacketJsonBody(b *testing.B) {
+	client := &Client{
+		codec: codec.NewJsonCodec(),
+	}
+	node := &face.OneNode{}
+	for _, size := range benchPacketSizes {
+		req := genPacketWriteReq(size)
+		b.Run(fmt.Sprintf("size-%v", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				pack := &proto.Packet{}
+				err := client.encodePacket(node, pack, req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				resp := json.NewReadFileRespJson()
+				err = client.decodePacket(pack, resp)
+				if err != nil {
+					b.Fatal(err)
+				}
+				client.releasePacket(pack)
+			}
+		})
+	}
+}
+
+func BenchmarkPacketRawFrame(b *testing.B) {
+	client := &Client{
+		codec: codec.NewJsonCodec(),
+	}
+	for _, size := range benchPacketSizes {
+		req := genPacketWriteReq(size)
+		b.Run(fmt.Sprintf("size-%v", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				pack, err := genFramePacket(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				resp := json.NewReadFileRespJson()
+				err = client.decodePacket(pack, resp)
+				if err != nil {
+					b.Fatal(err)
+				}
+				client.releasePacket(pack)
+			}
+		})
+	}
+}
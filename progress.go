@@ -0,0 +1,75 @@
+package tinyfs_client
+
+import (
+	"context"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+)
+
+/*
+ * upload throttle and progress
+ * - upload bytes admitted by throttle before sending
+ * - write over one part size sent by chunked upload parts when limited,
+ *   smaller write or server without chunk upload sent in one message,
+ *   which caps average rate only
+ * - progress reported per admitted chunk and when server answered
+ * - multi file read progress counts bytes of finished files,
+ *   not bytes on wire
+ * - single file read has no progress, data comes in one message
+ */
+
+//set upload bandwidth limit, nil means no limit
+func (f *Client) SetUploadLimit(para *face.ThrottlePara) error {
+	if para == nil {
+		f.Lock()
+		f.uploadThrottle = nil
+		f.Unlock()
+		return nil
+	}
+	throttle, err := face.NewThrottle(para)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	f.uploadThrottle = throttle
+	f.Unlock()
+	return nil
+}
+
+////////////////
+//private func
+////////////////
+
+//get upload throttle
+func (f *Client) getUploadThrottle() *face.Throttle {
+	f.RLock()
+	defer f.RUnlock()
+	return f.uploadThrottle
+}
+
+//wait upload bytes admitted
+//progress reported below total, total reported after server answered
+func (f *Client) waitUpload(
+		ctx context.Context,
+		size int64,
+		progress json.ProgressFunc,
+	) error {
+	throttle := f.getUploadThrottle()
+	reportProgress(progress, 0, size)
+	if throttle == nil {
+		return nil
+	}
+	cb := func(done int64) {
+		if done < size {
+			reportProgress(progress, done, size)
+		}
+	}
+	return throttle.Wait(ctx, size, cb)
+}
+
+//report progress if callback setup
+func reportProgress(progress json.ProgressFunc, done, total int64) {
+	if progress != nil {
+		progress(done, total)
+	}
+}
@@ -0,0 +1,38 @@
+package tinyfs_client
+
+import (
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/face"
+)
+
+/*
+ * protocol capability check
+ * - calls refused when server didn't advertise capability
+ * - optional calls skip nodes without capability
+ */
+
+////////////////
+//private func
+////////////////
+
+//check capability of node
+func (f *Client) checkCap(node *face.OneNode, capability string) error {
+	if node.HasCap(capability) {
+		return nil
+	}
+	return fmt.Errorf("%w, node:%v, version:%v, capability:%v",
+		ErrUnsupported, node.Address, node.GetVersion(), capability)
+}
+
+//get tags of nodes without capability
+//ok is false if no node has capability
+func (f *Client) excludeWithoutCap(capability string) (excludeTags []string, ok bool) {
+	for tag, node := range f.node.GetAllNode() {
+		if node.HasCap(capability) {
+			ok = true
+			continue
+		}
+		excludeTags = append(excludeTags, tag)
+	}
+	return excludeTags, ok
+}
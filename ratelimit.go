@@ -0,0 +1,78 @@
+package tinyfs_client
+
+import (
+	"context"
+	"github.com/andyzhou/tinyfs_client/face"
+)
+
+/*
+ * client side rate limit
+ * - read, write and list classes have separate budgets
+ * - client budget taken once per call, node budget per attempt
+ */
+
+//set rate limit para, nil means disable
+func (f *Client) SetRateLimit(para *face.RateLimitPara) {
+	f.Lock()
+	defer f.Unlock()
+	if para == nil {
+		f.limiter = nil
+		return
+	}
+	f.limiter = face.NewRateLimiter(para)
+}
+
+////////////////
+//private func
+////////////////
+
+//get rate limiter
+func (f *Client) getLimiter() *face.RateLimiter {
+	f.RLock()
+	defer f.RUnlock()
+	return f.limiter
+}
+
+//acquire client budget of operation
+func (f *Client) acquireClientLimit(
+		ctx context.Context,
+		op *operation,
+	) (func(), error) {
+	limiter := f.getLimiter()
+	if limiter == nil || op.class == "" {
+		return func() {}, nil
+	}
+	return limiter.AcquireClient(ctx, op.class)
+}
+
+//acquire node budget of operation
+func (f *Client) acquireNodeLimit(
+		ctx context.Context,
+		node *face.OneNode,
+		op *operation,
+	) (func(), error) {
+	limiter := f.getLimiter()
+	if limiter == nil || op.class == "" {
+		return func() {}, nil
+	}
+	return limiter.AcquireNode(ctx, node.Tag, op.class)
+}
+
+//drop node budgets and adaptive limits of removed nodes
+func (f *Client) dropNodeLimits() {
+	limiter := f.getLimiter()
+	adaptive := f.getAdaptive()
+	if limiter == nil && adaptive == nil {
+		return
+	}
+	tags := []string{}
+	for tag := range f.node.GetAllNode() {
+		tags = append(tags, tag)
+	}
+	if limiter != nil {
+		limiter.RetainNodes(tags)
+	}
+	if adaptive != nil {
+		adaptive.RetainNodes(tags)
+	}
+}
@@ -0,0 +1,122 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/define"
+	"reflect"
+	"sync"
+)
+
+/*
+ * custom message registry
+ * - server extensions register message id with request and response type
+ * - called by Client.Call, reuse request pipeline
+ */
+
+//one registered message
+type messageType struct {
+	reqType reflect.Type
+	respType reflect.Type
+	idempotent bool //retried on other node if true
+	class string //limit class, empty means no class limit
+}
+
+//global variable
+var (
+	_messageMap = map[int32]*messageType{}
+	_messageLocker sync.RWMutex
+)
+
+//custom message options
+type MessageOptions struct {
+	Idempotent bool //retried on other node if true
+	Class string //limit class, one of face.LimitClassOf*, empty means no class limit
+}
+
+//register custom message, not idempotent and no class limit
+//id should be in custom range, req and resp should be pointer of struct
+func RegisterMessage(id int32, req, resp interface{}) error {
+	return RegisterMessageWithOptions(id, req, resp, nil)
+}
+
+//register custom message with options, nil means defaults
+//id should be in custom range, req and resp should be pointer of struct
+func RegisterMessageWithOptions(
+		id int32,
+		req, resp interface{},
+		opts *MessageOptions,
+	) error {
+	//check
+	if id < define.MessageIdOfCustomMin || id > define.MessageIdOfCustomMax {
+		return fmt.Errorf("message id %v out of custom range [%v, %v]",
+			id, define.MessageIdOfCustomMin, define.MessageIdOfCustomMax)
+	}
+	if !isStructPtr(req) || !isStructPtr(resp) {
+		return errors.New("req and resp should be pointer of struct")
+	}
+	if opts == nil {
+		opts = &MessageOptions{}
+	}
+
+	_messageLocker.Lock()
+	defer _messageLocker.Unlock()
+	if _, ok := _messageMap[id]; ok {
+		return fmt.Errorf("message id %v had registered", id)
+	}
+	_messageMap[id] = &messageType{
+		reqType: reflect.TypeOf(req),
+		respType: reflect.TypeOf(resp),
+		idempotent: opts.Idempotent,
+		class: opts.Class,
+	}
+	return nil
+}
+
+//call registered custom message
+//every attempt decodes into own resp, winner copied into resp
+func (f *Client) Call(
+		ctx context.Context,
+		msgId int32,
+		req, resp interface{},
+	) error {
+	//check
+	_messageLocker.RLock()
+	msgType, ok := _messageMap[msgId]
+	_messageLocker.RUnlock()
+	if !ok {
+		return fmt.Errorf("message id %v not registered", msgId)
+	}
+	if reflect.TypeOf(req) != msgType.reqType || reflect.TypeOf(resp) != msgType.respType {
+		return fmt.Errorf("message id %v type not matched, req:%v, resp:%v",
+			msgId, msgType.reqType, msgType.respType)
+	}
+
+	//run request pipeline
+	op := &operation{
+		name: fmt.Sprintf("call:%v", msgId),
+		msgId: msgId,
+		idempotent: msgType.idempotent,
+		class: msgType.class,
+	}
+	newResp := func() interface{} {
+		return reflect.New(msgType.respType.Elem()).Interface()
+	}
+	respObj, err := do(ctx, f, op, req, newResp)
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(resp).Elem().Set(reflect.ValueOf(respObj).Elem())
+	return nil
+}
+
+////////////////
+//private func
+////////////////
+
+//check pointer of struct
+func isStructPtr(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+}
@@ -0,0 +1,66 @@
+package tinyfs_client
+
+import (
+	"context"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"testing"
+)
+
+/*
+ * custom message registry test
+ * - options kept by registry, defaults for short form
+ * - resp of winner attempt copied into caller resp
+ */
+
+//custom message
+type customReq struct {
+	Id int `json:"id"`
+}
+type customResp struct {
+	Name string `json:"name"`
+	Stale string `json:"stale"`
+}
+
+func TestRegisterMessage(t *testing.T) {
+	id := int32(define.MessageIdOfCustomMin)
+	t.Cleanup(func() {
+		_messageLocker.Lock()
+		defer _messageLocker.Unlock()
+		delete(_messageMap, id)
+		delete(_messageMap, id + 2)
+	})
+	err := RegisterMessageWithOptions(id, &customReq{}, &customResp{}, &MessageOptions{
+		Idempotent: true,
+		Class: face.LimitClassOfRead,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RegisterMessage(id, &customReq{}, &customResp{}); err == nil {
+		t.Fatal("expect duplicated id error")
+	}
+	if err = RegisterMessage(id + 1, customReq{}, &customResp{}); err == nil {
+		t.Fatal("expect type error")
+	}
+	if err = RegisterMessage(id + 2, &customReq{}, &customResp{}); err != nil {
+		t.Fatal(err)
+	}
+	if msgType := _messageMap[id + 2]; msgType.idempotent || msgType.class != "" {
+		t.Fatalf("unexpected defaults %+v", msgType)
+	}
+	if msgType := _messageMap[id]; !msgType.idempotent || msgType.class != face.LimitClassOfRead {
+		t.Fatalf("options lost %+v", msgType)
+	}
+
+	//call, caller resp replaced by decoded one
+	client, _, _ := newTraceClient(t)
+	resp := &customResp{Stale: "old"}
+	err = client.Call(context.Background(), id, &customReq{Id: 1}, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "custom" || resp.Stale != "" {
+		t.Fatalf("unexpected resp %+v", resp)
+	}
+}
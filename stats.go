@@ -0,0 +1,148 @@
+package tinyfs_client
+
+import (
+	"github.com/andyzhou/tinyfs_client/face"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultRecentErrors = 64 //recent errors kept
+)
+
+/*
+ * client statistics snapshot
+ * - per node stat kept on face.OneNode by every attempt
+ * - client wide counters kept by every call
+ * - snapshot is cheap, no request sent
+ */
+
+//client stat snapshot
+type ClientStat struct {
+	Nodes []face.NodeStat `json:"nodes"` //sorted by tag
+	HealthyNodes int `json:"healthyNodes"`
+	InFlight int64 `json:"inFlight"`
+	Requests int64 `json:"requests"`
+	Retries int64 `json:"retries"`
+	Hedges int64 `json:"hedges"`
+	Errors map[string]int64 `json:"errors"` //code -> count
+	MemCache *face.CacheStat `json:"memCache"` //nil if disabled
+	DiskCache *face.CacheStat `json:"diskCache"` //nil if disabled
+	RecentErrors []ErrorRecord `json:"recentErrors"` //newest first
+	CreateAt time.Time `json:"createAt"`
+}
+
+//one failed attempt record
+type ErrorRecord struct {
+	Time time.Time `json:"time"`
+	Op string `json:"op"`
+	Node string `json:"node"`
+	ShortUrl string `json:"shortUrl"`
+	Code string `json:"code"`
+	Err string `json:"err"`
+}
+
+//client wide counters
+type clientStat struct {
+	inFlight int64 //atomic value
+	requests int64 //atomic value
+	retries int64 //atomic value
+	hedges int64 //atomic value
+	errors map[string]int64
+	recentErrors []ErrorRecord //ring of failed attempts
+	recentIdx int
+	sync.Mutex
+}
+
+//get stat snapshot
+func (f *Client) Stats() *ClientStat {
+	stat := &ClientStat{
+		Nodes: []face.NodeStat{},
+		InFlight: atomic.LoadInt64(&f.stat.inFlight),
+		Requests: atomic.LoadInt64(&f.stat.requests),
+		Retries: atomic.LoadInt64(&f.stat.retries),
+		Hedges: atomic.LoadInt64(&f.stat.hedges),
+		Errors: map[string]int64{},
+		MemCache: f.GetCacheStat(),
+		DiskCache: f.GetDiskCacheStat(),
+		CreateAt: time.Now(),
+	}
+	f.stat.Lock()
+	for k, v := range f.stat.errors {
+		stat.Errors[k] = v
+	}
+	stat.RecentErrors = f.getRecentErrors()
+	f.stat.Unlock()
+
+	//per node stat
+	for _, node := range f.node.GetAllNode() {
+		nodeStat := node.GetStat()
+		if nodeStat.Healthy {
+			stat.HealthyNodes++
+		}
+		stat.Nodes = append(stat.Nodes, nodeStat)
+	}
+	sort.Slice(stat.Nodes, func(i, j int) bool {
+		return stat.Nodes[i].Tag < stat.Nodes[j].Tag
+	})
+	return stat
+}
+
+////////////////
+//private func
+////////////////
+
+//begin one call
+func (f *Client) beginCall() {
+	atomic.AddInt64(&f.stat.inFlight, 1)
+	atomic.AddInt64(&f.stat.requests, 1)
+}
+
+//end one call
+func (f *Client) endCall(err error) {
+	atomic.AddInt64(&f.stat.inFlight, -1)
+	if err == nil {
+		return
+	}
+	f.stat.Lock()
+	defer f.stat.Unlock()
+	if f.stat.errors == nil {
+		f.stat.errors = map[string]int64{}
+	}
+	f.stat.errors[errLabel(err)]++
+}
+
+//add failed attempt record
+func (f *Client) addErrorRecord(record ErrorRecord) {
+	f.stat.Lock()
+	defer f.stat.Unlock()
+	if len(f.stat.recentErrors) < DefaultRecentErrors {
+		f.stat.recentErrors = append(f.stat.recentErrors, record)
+		return
+	}
+	f.stat.recentErrors[f.stat.recentIdx] = record
+	f.stat.recentIdx = (f.stat.recentIdx + 1) % DefaultRecentErrors
+}
+
+//get recent errors newest first, run in locker
+func (f *Client) getRecentErrors() []ErrorRecord {
+	size := len(f.stat.recentErrors)
+	records := make([]ErrorRecord, 0, size)
+	for i := 1; i <= size; i++ {
+		idx := (f.stat.recentIdx - i + size) % size
+		records = append(records, f.stat.recentErrors[idx])
+	}
+	return records
+}
+
+//inc retry count
+func (f *Client) incRetry() {
+	atomic.AddInt64(&f.stat.retries, 1)
+}
+
+//inc hedge count
+func (f *Client) incHedge() {
+	atomic.AddInt64(&f.stat.hedges, 1)
+}
@@ -0,0 +1,28 @@
+package tinyfs_client
+
+import (
+	"github.com/andyzhou/tinyfs_client/tracing"
+)
+
+/*
+ * request tracing
+ * - request span around retries, attempt span per node
+ * - trace context injected into packet meta
+ */
+
+//set tracer, nil means no-op tracer
+func (f *Client) SetTracer(tracer tracing.Tracer) {
+	if tracer == nil {
+		tracer = tracing.NewNoopTracer()
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.tracer = tracer
+}
+
+//get tracer
+func (f *Client) getTracer() tracing.Tracer {
+	f.RLock()
+	defer f.RUnlock()
+	return f.tracer
+}
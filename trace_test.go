@@ -0,0 +1,262 @@
+package tinyfs_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/tracing"
+	"github.com/andyzhou/tinyrpc"
+	"github.com/andyzhou/tinyrpc/proto"
+	"net"
+	"sync"
+	"testing"
+)
+
+/*
+ * request tracing test
+ * - local rpc service answers list and refuses delete
+ * - recording tracer keeps every span and injects trace parent
+ */
+const (
+	traceMetaKey = "traceparent"
+	traceCallerKey = "tenant"
+)
+
+//recorded span
+type recordSpan struct {
+	name string
+	attrs map[string]interface{}
+	err error
+	ended bool
+	sync.Mutex
+}
+
+func (s *recordSpan) SetAttr(key string, val interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.attrs[key] = val
+}
+func (s *recordSpan) SetError(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+func (s *recordSpan) Inject(carrier map[string]string) {
+	carrier[traceMetaKey] = "00-" + s.name
+}
+func (s *recordSpan) End() {
+	s.Lock()
+	defer s.Unlock()
+	s.ended = true
+}
+
+//get attr of span
+func (s *recordSpan) getAttr(key string) interface{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.attrs[key]
+}
+
+//recording tracer
+type recordTracer struct {
+	spans []*recordSpan
+	sync.Mutex
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	span := &recordSpan{
+		name: name,
+		attrs: map[string]interface{}{},
+	}
+	t.Lock()
+	t.spans = append(t.spans, span)
+	t.Unlock()
+	return ctx, span
+}
+
+//get span by name
+func (t *recordTracer) getSpan(name string) *recordSpan {
+	t.Lock()
+	defer t.Unlock()
+	for _, v := range t.spans {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+//local rpc service
+type traceServer struct {
+	service *tinyrpc.Service
+	addr string
+	metas []string //packet meta of received requests
+	msgIds []int32 //message id of received requests
+	sync.Mutex
+}
+
+//start local rpc service on free port
+func startTraceServer(t *testing.T) *traceServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	this := &traceServer{
+		service: tinyrpc.NewService(&tinyrpc.ServicePara{Port: port}),
+		addr: fmt.Sprintf("127.0.0.1:%v", port),
+	}
+	this.service.SetCBForGeneral(this.cbForGenReq)
+	err = this.service.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(this.service.Quit)
+	return this
+}
+
+//answer list and custom message, refuse delete and handshake
+func (s *traceServer) cbForGenReq(addr string, in *proto.Packet) (*proto.Packet, error) {
+	out := &proto.Packet{
+		MessageId: in.MessageId,
+	}
+	switch in.MessageId {
+	case define.MessageIdOfHandshake:
+		//old server, base capabilities
+		out.ErrCode = define.ErrCodeOfNoCallBack
+		return out, nil
+	case define.MessageIdOfDelete:
+		out.ErrCode = define.ErrCodeOfInterError
+		out.ErrMsg = "delete failed"
+	case define.MessageIdOfListFile:
+		out.Data = []byte(`{"list":[]}`)
+	case define.MessageIdOfCustomMin:
+		out.Data = []byte(`{"name":"custom"}`)
+	}
+	s.Lock()
+	s.metas = append(s.metas, in.Act)
+	s.msgIds = append(s.msgIds, in.MessageId)
+	s.Unlock()
+	return out, nil
+}
+
+//get packet meta of last request
+func (s *traceServer) lastMeta(key string) string {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.metas) <= 0 {
+		return ""
+	}
+	return getPacketMeta(&proto.Packet{Act: s.metas[len(s.metas) - 1]}, key)
+}
+
+//count received requests of message id
+func (s *traceServer) countOf(msgId int32) int {
+	s.Lock()
+	defer s.Unlock()
+	count := 0
+	for _, v := range s.msgIds {
+		if v == msgId {
+			count++
+		}
+	}
+	return count
+}
+
+//init client with recording tracer
+func newTraceClient(t *testing.T) (*Client, *recordTracer, *traceServer) {
+	server := startTraceServer(t)
+	client := NewClient()
+	t.Cleanup(client.Quit)
+	tracer := &recordTracer{}
+	client.SetTracer(tracer)
+	err := client.AddNode(server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, tracer, server
+}
+
+func TestTraceSucceed(t *testing.T) {
+	client, tracer, server := newTraceClient(t)
+	ctx := WithPacketMeta(context.Background(), traceCallerKey, "t1")
+	_, err := client.ListFilesWithContext(ctx, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//request span
+	reqSpan := tracer.getSpan("tinyfs.listFile")
+	if reqSpan == nil || !reqSpan.ended {
+		t.Fatalf("request span not recorded or ended, %v", reqSpan)
+	}
+	if reqSpan.err != nil {
+		t.Fatalf("request span error %v", reqSpan.err)
+	}
+	if v := reqSpan.getAttr(tracing.AttrOfOp); v != "listFile" {
+		t.Fatalf("request span op %v", v)
+	}
+	if v := reqSpan.getAttr(tracing.AttrOfNode); v != server.addr {
+		t.Fatalf("request span node %v", v)
+	}
+	if v := reqSpan.getAttr(tracing.AttrOfAttempt); v != 0 {
+		t.Fatalf("request span attempt %v", v)
+	}
+
+	//attempt span
+	attemptSpan := tracer.getSpan("tinyfs.listFile.attempt")
+	if attemptSpan == nil || !attemptSpan.ended {
+		t.Fatalf("attempt span not recorded or ended, %v", attemptSpan)
+	}
+	if attemptSpan.err != nil {
+		t.Fatalf("attempt span error %v", attemptSpan.err)
+	}
+	if v := attemptSpan.getAttr(tracing.AttrOfNode); v != server.addr {
+		t.Fatalf("attempt span node %v", v)
+	}
+	if v := attemptSpan.getAttr(tracing.AttrOfMessageId); v != int32(define.MessageIdOfListFile) {
+		t.Fatalf("attempt span message id %v", v)
+	}
+	if v, _ := attemptSpan.getAttr(tracing.AttrOfPayloadSize).(int); v <= 0 {
+		t.Fatalf("attempt span payload size %v", v)
+	}
+	if v := attemptSpan.getAttr(tracing.AttrOfErrorCode); v != nil {
+		t.Fatalf("attempt span error code %v", v)
+	}
+
+	//trace parent of attempt and caller meta sent to server
+	if v := server.lastMeta(traceMetaKey); v != "00-tinyfs.listFile.attempt" {
+		t.Fatalf("trace meta not injected, got %q", v)
+	}
+	if v := server.lastMeta(traceCallerKey); v != "t1" {
+		t.Fatalf("caller meta lost, got %q", v)
+	}
+}
+
+func TestTraceCodeError(t *testing.T) {
+	client, tracer, _ := newTraceClient(t)
+	err := client.DelFiles("a", "b")
+	var codeErr *CodeError
+	if !errors.As(err, &codeErr) {
+		t.Fatalf("expect code error, got %v", err)
+	}
+	code := fmt.Sprintf("%v", define.ErrCodeOfInterError)
+	for _, name := range []string{"tinyfs.delete", "tinyfs.delete.attempt"} {
+		span := tracer.getSpan(name)
+		if span == nil || !span.ended {
+			t.Fatalf("span %v not recorded or ended", name)
+		}
+		if !errors.As(span.err, &codeErr) {
+			t.Fatalf("span %v error %v", name, span.err)
+		}
+		if v := span.getAttr(tracing.AttrOfErrorCode); v != code {
+			t.Fatalf("span %v error code %v", name, v)
+		}
+	}
+	if v := tracer.getSpan("tinyfs.delete.attempt").getAttr(tracing.AttrOfAttempt); v != 0 {
+		t.Fatalf("attempt span attempt %v", v)
+	}
+}
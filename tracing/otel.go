@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+ * opentelemetry tracer adapter
+ */
+
+//face info
+type OtelTracer struct {
+	tracer trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+//construct
+//global text map propagator used if not assigned
+func NewOtelTracer(
+		tracer trace.Tracer,
+		propagators ...propagation.TextMapPropagator,
+	) *OtelTracer {
+	if tracer == nil {
+		tracer = otel.Tracer("github.com/andyzhou/tinyfs_client")
+	}
+	this := &OtelTracer{
+		tracer: tracer,
+		propagator: otel.GetTextMapPropagator(),
+	}
+	if len(propagators) > 0 && propagators[0] != nil {
+		this.propagator = propagators[0]
+	}
+	return this
+}
+
+//start span
+func (t *OtelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &otelSpan{
+		ctx: ctx,
+		span: span,
+		propagator: t.propagator,
+	}
+}
+
+//otel span
+type otelSpan struct {
+	ctx context.Context
+	span trace.Span
+	propagator propagation.TextMapPropagator
+}
+
+//set attribute
+func (s *otelSpan) SetAttr(key string, val interface{}) {
+	var (
+		attr attribute.KeyValue
+	)
+	switch v := val.(type) {
+	case string:
+		attr = attribute.String(key, v)
+	case int:
+		attr = attribute.Int(key, v)
+	case int32:
+		attr = attribute.Int64(key, int64(v))
+	case int64:
+		attr = attribute.Int64(key, v)
+	case bool:
+		attr = attribute.Bool(key, v)
+	case float64:
+		attr = attribute.Float64(key, v)
+	default:
+		attr = attribute.String(key, fmt.Sprintf("%v", v))
+	}
+	s.span.SetAttributes(attr)
+}
+
+//set error
+func (s *otelSpan) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+//inject trace context
+func (s *otelSpan) Inject(carrier map[string]string) {
+	s.propagator.Inject(s.ctx, propagation.MapCarrier(carrier))
+}
+
+//end span
+func (s *otelSpan) End() {
+	s.span.End()
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+)
+
+/*
+ * tracer face
+ * - one span per request and per attempt
+ * - trace context injected into packet meta
+ */
+
+//span attribute key
+const (
+	AttrOfOp = "tinyfs.op"
+	AttrOfNode = "tinyfs.node"
+	AttrOfMessageId = "tinyfs.message_id"
+	AttrOfPayloadSize = "tinyfs.payload_size"
+	AttrOfAttempt = "tinyfs.attempt"
+	AttrOfErrorCode = "tinyfs.error_code"
+)
+
+//tracer interface
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+//span interface
+type Span interface {
+	SetAttr(key string, val interface{})
+	SetError(err error)
+	Inject(carrier map[string]string) //inject trace context
+	End()
+}
+
+//no-op tracer, default one
+type NoopTracer struct {
+}
+
+//construct
+func NewNoopTracer() *NoopTracer {
+	this := &NoopTracer{}
+	return this
+}
+
+//start span
+func (t *NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+//no-op span
+type noopSpan struct {
+}
+
+func (s noopSpan) SetAttr(key string, val interface{}) {}
+func (s noopSpan) SetError(err error) {}
+func (s noopSpan) Inject(carrier map[string]string) {}
+func (s noopSpan) End() {}
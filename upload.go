@@ -0,0 +1,558 @@
+package tinyfs_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/andyzhou/tinyfs_client/define"
+	"github.com/andyzhou/tinyfs_client/face"
+	"github.com/andyzhou/tinyfs_client/json"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+ * resumable chunked upload
+ * - start session on one node, upload numbered parts, query and commit
+ * - every part is retried on its own, pinned to session node
+ * - parts uploaded in parallel, spread over masters sharing the session
+ * - session state persisted locally, upload resumed after restart
+ */
+const (
+	DefaultUploadPartSize = 1024 * 1024 * 4 //4MB
+)
+
+//resumable upload para
+type UploadPara struct {
+	Key string //local session key, same key resumes upload
+	Name string
+	Type string
+	Reader io.ReaderAt
+	Size int64
+	PartSize int64 //zero means DefaultUploadPartSize
+	Parallelism int //parts uploaded at same time, zero means one
+	Progress json.ProgressFunc //optional
+}
+
+//set upload session dir, empty means not persisted
+func (f *Client) SetUploadSessionDir(dir string) error {
+	if dir == "" {
+		f.Lock()
+		f.uploadStore = nil
+		f.Unlock()
+		return nil
+	}
+	store, err := face.NewUploadStore(dir)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	f.uploadStore = store
+	f.Unlock()
+	return nil
+}
+
+//start upload session
+//session persisted by key if session dir setup, empty key means not persisted
+func (f *Client) StartUpload(
+		ctx context.Context,
+		key string,
+		req *json.UploadStartReqJson,
+	) (*json.UploadSession, error) {
+	//check
+	if req == nil || req.Name == "" || req.Size <= 0 || req.PartSize <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	req.Parts = int((req.Size + req.PartSize - 1) / req.PartSize)
+
+	//start session on picked node
+	para := &callPara{}
+	resp, err := do(ctx, f, opOfUploadStart, req, json.NewUploadStartRespJson, para)
+	if err != nil {
+		return nil, err
+	}
+	if resp.UploadId == "" {
+		return nil, errors.New("empty upload id")
+	}
+
+	//init local session
+	session := json.NewUploadSession()
+	session.Key = key
+	session.UploadId = resp.UploadId
+	session.Addr = para.node.Address
+	session.Name = req.Name
+	session.Type = req.Type
+	session.Size = req.Size
+	session.PartSize = req.PartSize
+	session.Parts = req.Parts
+	session.Md5 = req.Md5
+	session.Sha256 = req.Sha256
+	session.CreateAt = time.Now().Unix()
+	err = f.saveSession(session)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+//upload one part of session, part number from 0
+//retried on session node for transport failure
+func (f *Client) UploadPart(
+		ctx context.Context,
+		session *json.UploadSession,
+		partNo int,
+		data []byte,
+	) error {
+	//check
+	if session == nil {
+		return errors.New("invalid parameter")
+	}
+	return f.uploadPart(ctx, session, partNo, data, session.Addr)
+}
+
+//query parts received by server
+//local session updated by server state
+func (f *Client) UploadStatus(
+		ctx context.Context,
+		session *json.UploadSession,
+	) ([]int, error) {
+	//check
+	if session == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	req := json.NewUploadStatusReqJson()
+	req.UploadId = session.UploadId
+	para := &callPara{
+		addr: session.Addr,
+	}
+	resp, err := do(ctx, f, opOfUploadStatus, req, json.NewUploadStatusRespJson, para)
+	if err != nil {
+		return nil, err
+	}
+	session.SetDone(resp.Parts)
+	err = f.saveSession(session)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Parts, nil
+}
+
+//commit upload session
+//server assembles parts and verifies whole file digest
+func (f *Client) CommitUpload(
+		ctx context.Context,
+		session *json.UploadSession,
+	) (*json.UploadCommitRespJson, error) {
+	//check
+	if session == nil {
+		return nil, errors.New("invalid parameter")
+	}
+	req := json.NewUploadCommitReqJson()
+	req.UploadId = session.UploadId
+	req.Parts = session.Parts
+	req.Md5 = session.Md5
+	req.Sha256 = session.Sha256
+	para := &callPara{
+		addr: session.Addr,
+	}
+	resp, err := do(ctx, f, opOfUploadCommit, req, json.NewUploadCommitRespJson, para)
+	if err != nil {
+		var codeErr *CodeError
+		if errors.As(err, &codeErr) {
+			//rejected by server, session can't be committed again
+			f.dropSession(session.Key)
+		}
+		return nil, err
+	}
+
+	//verify digest of assembled file
+	//mismatched file is not resumable, drop session
+	if resp.Md5 != "" && resp.Md5 != session.Md5 {
+		f.dropSession(session.Key)
+		return nil, &ChecksumError{
+			ShortUrl: resp.ShortUrl,
+			Algo: "md5",
+			Expect: session.Md5,
+			Actual: resp.Md5,
+		}
+	}
+	if session.Sha256 != "" && resp.Sha256 != "" && resp.Sha256 != session.Sha256 {
+		f.dropSession(session.Key)
+		return nil, &ChecksumError{
+			ShortUrl: resp.ShortUrl,
+			Algo: "sha256",
+			Expect: session.Sha256,
+			Actual: resp.Sha256,
+		}
+	}
+	f.dropSession(session.Key)
+	return resp, nil
+}
+
+//upload file by resumable session
+//same key resumes parts not received by server
+//parts uploaded in parallel if para parallelism setup
+func (f *Client) UploadResumable(
+		ctx context.Context,
+		para *UploadPara,
+	) (*json.UploadCommitRespJson, error) {
+	//check
+	if para == nil || para.Name == "" || para.Reader == nil || para.Size <= 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	if para.PartSize <= 0 {
+		para.PartSize = DefaultUploadPartSize
+	}
+
+	//hash whole file, persisted session resumed only for same content
+	req, err := f.genUploadStartReq(para)
+	if err != nil {
+		return nil, err
+	}
+
+	//resume or start session
+	session, err := f.resumeSession(ctx, para, req)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		session, err = f.StartUpload(ctx, para.Key, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//upload missed parts
+	err = f.uploadParts(ctx, session, para)
+	if err != nil {
+		return nil, err
+	}
+
+	//commit session
+	resp, err := f.CommitUpload(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	reportProgress(para.Progress, session.Size, session.Size)
+	return resp, nil
+}
+
+////////////////
+//private func
+////////////////
+
+//write file by not persisted upload session
+//part uploads paced by upload throttle
+func (f *Client) writeByParts(
+		ctx context.Context,
+		req *json.WriteFileReqJson,
+	) (*json.WriteFileRespJson, error) {
+	size := int64(len(req.Data))
+	startReq := json.NewUploadStartReqJson()
+	startReq.Name = req.Name
+	startReq.Type = req.Type
+	startReq.Size = size
+	startReq.PartSize = DefaultUploadPartSize
+	startReq.Md5 = req.Md5
+	startReq.Sha256 = req.Sha256
+	session, err := f.StartUpload(ctx, "", startReq)
+	if err != nil {
+		return nil, err
+	}
+	para := &UploadPara{
+		Name: req.Name,
+		Type: req.Type,
+		Reader: bytes.NewReader(req.Data),
+		Size: size,
+		PartSize: DefaultUploadPartSize,
+		Progress: req.Progress,
+	}
+	err = f.uploadParts(ctx, session, para)
+	if err != nil {
+		return nil, err
+	}
+	commitResp, err := f.CommitUpload(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	respObj := json.NewWriteFileRespJson()
+	respObj.ShortUrl = commitResp.ShortUrl
+	reportProgress(req.Progress, size, size)
+	return respObj, nil
+}
+
+//upload missed parts of session by parallel workers
+//first failed part cancels the others
+func (f *Client) uploadParts(
+		ctx context.Context,
+		session *json.UploadSession,
+		para *UploadPara,
+	) error {
+	var (
+		done int64
+		firstErr error
+		locker sync.Mutex
+		wg sync.WaitGroup
+	)
+	parallelism := para.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	if parallelism > session.Parts {
+		parallelism = session.Parts
+	}
+	addrs := f.partAddrs(session)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	//count uploaded parts
+	for partNo := 0; partNo < session.Parts; partNo++ {
+		if session.HasPart(partNo) {
+			_, size := partRange(session, partNo)
+			done += size
+		}
+	}
+	reportProgress(para.Progress, done, session.Size)
+
+	//feed missed parts
+	partChan := make(chan int)
+	go func() {
+		defer close(partChan)
+		for partNo := 0; partNo < session.Parts; partNo++ {
+			if session.HasPart(partNo) {
+				continue
+			}
+			select {
+			case partChan <- partNo:
+			case <- ctx.Done():
+				return
+			}
+		}
+	}()
+
+	//run workers, every worker owns one part buffer
+	sf := func() {
+		defer wg.Done()
+		buf := make([]byte, session.PartSize)
+		for partNo := range partChan {
+			offset, size := partRange(session, partNo)
+			data := buf[:size]
+			n, err := para.Reader.ReadAt(data, offset)
+			if errors.Is(err, io.EOF) {
+				//last part may end at eof, short read means file shrank
+				err = nil
+				if n < len(data) {
+					err = io.ErrUnexpectedEOF
+				}
+			}
+			if err == nil {
+				err = f.uploadPart(ctx, session, partNo, data, addrs[partNo % len(addrs)])
+			}
+			locker.Lock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				locker.Unlock()
+				cancel()
+				return
+			}
+			done += size
+			if done < session.Size {
+				reportProgress(para.Progress, done, session.Size)
+			}
+			locker.Unlock()
+		}
+	}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go sf()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+//upload one part to node of address
+//part on other master falls back to session node on failure
+func (f *Client) uploadPart(
+		ctx context.Context,
+		session *json.UploadSession,
+		partNo int,
+		data []byte,
+		addr string,
+	) error {
+	//check
+	if session == nil || partNo < 0 || partNo >= session.Parts {
+		return errors.New("invalid parameter")
+	}
+	_, size := partRange(session, partNo)
+	if int64(len(data)) != size {
+		return errors.New("invalid part size")
+	}
+
+	//wait upload bytes admitted
+	err := f.waitUpload(ctx, size, nil)
+	if err != nil {
+		return err
+	}
+
+	//send part to target node
+	req := json.NewUploadPartReqJson()
+	req.UploadId = session.UploadId
+	req.PartNo = partNo
+	req.Md5 = face.Md5Hex(data)
+	req.Data = data
+	para := &callPara{
+		addr: addr,
+	}
+	resp, err := do(ctx, f, opOfUploadPart, req, json.NewUploadPartRespJson, para)
+	if err != nil && addr != session.Addr && ctx.Err() == nil {
+		para.addr = session.Addr
+		resp, err = do(ctx, f, opOfUploadPart, req, json.NewUploadPartRespJson, para)
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Md5 != "" && resp.Md5 != req.Md5 {
+		return &ChecksumError{
+			ShortUrl: session.Name,
+			Algo: "md5",
+			Expect: req.Md5,
+			Actual: resp.Md5,
+		}
+	}
+	session.MarkDone(partNo)
+	return f.saveSession(session)
+}
+
+//get node addresses for parts, session node first
+//other masters used only if all share the upload session
+func (f *Client) partAddrs(session *json.UploadSession) []string {
+	addrs := []string{session.Addr}
+	sessionNode, _ := f.node.GetNodeByAddr(session.Addr)
+	if sessionNode == nil || !sessionNode.HasCap(define.CapOfSharedUpload) {
+		return addrs
+	}
+	others := []string{}
+	for _, node := range f.node.GetAllNode() {
+		if node.Address == session.Addr || !node.IsHealthy() || node.IsDraining() {
+			continue
+		}
+		if node.HasCap(define.CapOfChunkUpload) && node.HasCap(define.CapOfSharedUpload) {
+			others = append(others, node.Address)
+		}
+	}
+	sort.Strings(others)
+	return append(addrs, others...)
+}
+
+//resume persisted session, nil if not resumable
+func (f *Client) resumeSession(
+		ctx context.Context,
+		para *UploadPara,
+		req *json.UploadStartReqJson,
+	) (*json.UploadSession, error) {
+	f.RLock()
+	store := f.uploadStore
+	f.RUnlock()
+	if store == nil || para.Key == "" {
+		return nil, nil
+	}
+	session, err := store.Load(para.Key)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if session.Name != req.Name || session.Size != req.Size || session.PartSize != req.PartSize ||
+		session.Md5 != req.Md5 || session.Sha256 != req.Sha256 {
+		//file changed, start over
+		store.Delete(para.Key)
+		return nil, nil
+	}
+
+	//sync received parts from server
+	_, err = f.UploadStatus(ctx, session)
+	if errors.Is(err, ErrNoSuchData) || errors.Is(err, face.ErrNoNode) {
+		//session expired or node removed, start over
+		store.Delete(para.Key)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.getLogger().Info("resume upload session",
+		"key", session.Key,
+		"uploadId", session.UploadId,
+		LogKeyOfNode, session.Addr,
+		"parts", len(session.Done))
+	return session, nil
+}
+
+//gen upload start request with whole file digest
+func (f *Client) genUploadStartReq(para *UploadPara) (*json.UploadStartReqJson, error) {
+	f.RLock()
+	algo := f.digestAlgo
+	f.RUnlock()
+
+	//hash whole file
+	md5Hash := md5.New()
+	writers := []io.Writer{md5Hash}
+	var shaHash hash.Hash
+	if algo == define.DigestOfSha256 {
+		shaHash = sha256.New()
+		writers = append(writers, shaHash)
+	}
+	_, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(para.Reader, 0, para.Size))
+	if err != nil {
+		return nil, err
+	}
+
+	//init request
+	req := json.NewUploadStartReqJson()
+	req.Name = para.Name
+	req.Type = para.Type
+	req.Size = para.Size
+	req.PartSize = para.PartSize
+	req.Md5 = hex.EncodeToString(md5Hash.Sum(nil))
+	if shaHash != nil {
+		req.Sha256 = hex.EncodeToString(shaHash.Sum(nil))
+	}
+	return req, nil
+}
+
+//save session if persisted
+func (f *Client) saveSession(session *json.UploadSession) error {
+	f.RLock()
+	store := f.uploadStore
+	f.RUnlock()
+	if store == nil || session.Key == "" {
+		return nil
+	}
+	return store.Save(session)
+}
+
+//drop persisted session
+func (f *Client) dropSession(key string) {
+	f.RLock()
+	store := f.uploadStore
+	f.RUnlock()
+	if store == nil || key == "" {
+		return
+	}
+	store.Delete(key)
+}
+
+//get offset and size of part
+func partRange(session *json.UploadSession, partNo int) (int64, int64) {
+	offset := int64(partNo) * session.PartSize
+	size := session.PartSize
+	if offset + size > session.Size {
+		size = session.Size - offset
+	}
+	return offset, size
+}